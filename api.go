@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/directdownload"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+	"github.com/gorilla/mux"
+)
+
+// apiJob is the JSON representation of a jobInformation
+type apiJob struct {
+	ID     creamqueue.JobID `json:"id"`
+	Status string           `json:"status"`
+
+	CreatedAt time.Time `json:"created_at"`
+	StartedAt time.Time `json:"started_at"`
+	StoppedAt time.Time `json:"stopped_at"`
+
+	URL         string   `json:"url"`
+	Tags        []string `json:"tags"`
+	SubmittedBy string   `json:"submitted_by"`
+	Priority    string   `json:"priority"`
+	Group       string   `json:"group"`
+
+	FormatProfile string `json:"format_profile"`
+	RecodeProfile string `json:"recode_profile"`
+
+	SubtitleLanguages []string `json:"subtitle_languages"`
+	AutoSubtitles     bool     `json:"auto_subtitles"`
+	SplitChapters     bool     `json:"split_chapters"`
+
+	Playlist creamqueue.PlaylistOptions `json:"playlist"`
+
+	NotBefore        time.Time `json:"not_before"`
+	InDownloadWindow bool      `json:"in_download_window"`
+	ScheduledUntil   time.Time `json:"scheduled_until"`
+
+	PlaylistIndex int    `json:"playlist_index,omitempty"`
+	PlaylistTitle string `json:"playlist_title,omitempty"`
+
+	ParentID         creamqueue.JobID   `json:"parent_id,omitempty"`
+	Children         []creamqueue.JobID `json:"children"`
+	ChildCounts      *groupCounts       `json:"child_counts,omitempty"`
+	GroupCompletedAt time.Time          `json:"group_completed_at"`
+
+	Progress  string   `json:"progress"`
+	Failures  []string `json:"failures"`
+	Title     string   `json:"title"`
+	CreamyURL string   `json:"creamy_url"`
+}
+
+func makeAPIJob(job *jobInformation) apiJob {
+	failures := make([]string, len(job.Failures))
+	for i, failure := range job.Failures {
+		failures[i] = failure.Error.Error()
+	}
+
+	return apiJob{
+		ID:     job.ID,
+		Status: job.Status,
+
+		CreatedAt: job.CreatedAt,
+		StartedAt: job.StartedAt,
+		StoppedAt: job.StoppedAt,
+
+		URL:         job.Data.URL,
+		Tags:        job.Data.Tags,
+		SubmittedBy: job.Data.SubmittedBy,
+		Priority:    job.Data.Priority.String(),
+		Group:       job.Data.FairnessGroup(),
+
+		FormatProfile: job.Data.FormatProfile,
+		RecodeProfile: job.Data.RecodeProfile,
+
+		SubtitleLanguages: job.Data.SubtitleLanguages,
+		AutoSubtitles:     job.Data.AutoSubtitles,
+		SplitChapters:     job.Data.SplitChapters,
+
+		Playlist: job.Data.Playlist,
+
+		NotBefore:        job.Data.NotBefore,
+		InDownloadWindow: job.Data.InDownloadWindow,
+		ScheduledUntil:   job.ScheduledUntil,
+
+		PlaylistIndex: job.Data.PlaylistIndex,
+		PlaylistTitle: job.Data.PlaylistTitle,
+
+		ParentID:         job.ParentID,
+		Children:         job.Children,
+		GroupCompletedAt: job.GroupCompletedAt,
+
+		Progress:  string(job.Progress),
+		Failures:  failures,
+		Title:     job.Result.Title,
+		CreamyURL: job.Result.CreamyURL,
+	}
+}
+
+// apiCreateJobRequest is the JSON body accepted when queueing a job through the API
+type apiCreateJobRequest struct {
+	URL      string   `json:"url"`
+	Tags     []string `json:"tags"`
+	Priority string   `json:"priority"`
+	Group    string   `json:"group"`
+
+	NotBefore        time.Time `json:"not_before"`
+	InDownloadWindow bool      `json:"in_download_window"`
+
+	TitleTemplate       string `json:"title_template"`
+	DescriptionTemplate string `json:"description_template"`
+	FormatProfile       string `json:"format_profile"`
+	RecodeProfile       string `json:"recode_profile"`
+
+	SubtitleLanguages []string `json:"subtitle_languages"`
+	AutoSubtitles     bool     `json:"auto_subtitles"`
+	SplitChapters     bool     `json:"split_chapters"`
+
+	Playlist creamqueue.PlaylistOptions `json:"playlist"`
+}
+
+// apiChangePriorityRequest is the JSON body accepted when changing the priority of a waiting job
+type apiChangePriorityRequest struct {
+	Priority string `json:"priority"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Println("error writing json response:", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{message})
+}
+
+func handlerAPIListJobs(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	onlyMine := r.URL.Query().Get("mine") != ""
+
+	jobs, unlock := jobRepo.RLockMatching(func(job *jobInformation) bool {
+		return canSeeJob(user, onlyMine, job)
+	})
+	defer unlock()
+
+	byID := make(map[creamqueue.JobID]*jobInformation, len(jobs))
+	for _, job := range jobs {
+		byID[job.ID] = job
+	}
+
+	apiJobs := make([]apiJob, len(jobs))
+	for i, job := range jobs {
+		apiJobs[i] = makeAPIJob(job)
+
+		if len(job.Children) > 0 || len(job.PendingChildren) > 0 {
+			children := []*jobInformation{}
+			for _, childID := range job.Children {
+				if child, ok := byID[childID]; ok {
+					children = append(children, child)
+				}
+			}
+			counts := countChildren(job, children)
+			apiJobs[i].ChildCounts = &counts
+		}
+	}
+
+	writeJSON(w, 200, apiJobs)
+}
+
+// jobData returns the job asked for, or an error if its options are invalid
+func (request *apiCreateJobRequest) jobData(r *http.Request) (creamqueue.JobData, error) {
+	if request.Tags == nil {
+		request.Tags = []string{}
+	}
+
+	priority, err := creamqueue.ParseJobPriority(request.Priority)
+	if err != nil {
+		return creamqueue.JobData{}, err
+	}
+
+	data := creamqueue.JobData{
+		URL:         request.URL,
+		Tags:        request.Tags,
+		SubmittedBy: requestUser(r),
+		Priority:    priority,
+		GroupKey:    request.Group,
+
+		NotBefore:        request.NotBefore,
+		InDownloadWindow: request.InDownloadWindow,
+
+		TitleTemplate:       request.TitleTemplate,
+		DescriptionTemplate: request.DescriptionTemplate,
+		FormatProfile:       request.FormatProfile,
+		RecodeProfile:       request.RecodeProfile,
+
+		SubtitleLanguages: cleanSubtitleLanguages(request.SubtitleLanguages),
+		AutoSubtitles:     request.AutoSubtitles,
+		SplitChapters:     request.SplitChapters,
+
+		Playlist: request.Playlist,
+	}
+
+	if err := validateJobOptions(&data); err != nil {
+		return creamqueue.JobData{}, err
+	}
+
+	return data, nil
+}
+
+func handlerAPICreateJob(w http.ResponseWriter, r *http.Request) {
+	request := apiCreateJobRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, 400, "bad data")
+		return
+	}
+
+	if request.URL == "" {
+		writeJSONError(w, 422, "missing \"url\" value")
+		return
+	}
+
+	data, err := request.jobData(r)
+	if err != nil {
+		writeJSONError(w, 422, err.Error())
+		return
+	}
+
+	id := queueJob(data)
+
+	writeJSON(w, 201, struct {
+		ID creamqueue.JobID `json:"id"`
+	}{id})
+}
+
+func handlerAPIChangeJobPriority(w http.ResponseWriter, r *http.Request) {
+	request := apiChangePriorityRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, 400, "bad data")
+		return
+	}
+
+	priority, err := creamqueue.ParseJobPriority(request.Priority)
+	if err != nil {
+		writeJSONError(w, 422, err.Error())
+		return
+	}
+
+	id := creamqueue.JobID(mux.Vars(r)["id"])
+	if !canManageJob(requestUser(r), id) {
+		writeJSONError(w, 404, "job not found")
+		return
+	}
+
+	if !updateWaitingJob(id, func(data *creamqueue.JobData) {
+		data.Priority = priority
+	}) {
+		writeJSONError(w, 409, "job is no longer waiting")
+		return
+	}
+
+	writeJSON(w, 200, struct {
+		ID       creamqueue.JobID `json:"id"`
+		Priority string           `json:"priority"`
+	}{id, priority.String()})
+}
+
+// apiDryRunRulesRequest is the JSON body accepted when trying the tag rules against a URL
+type apiDryRunRulesRequest struct {
+	URL  string   `json:"url"`
+	Tags []string `json:"tags"`
+}
+
+func handlerAPIDryRunRules(w http.ResponseWriter, r *http.Request) {
+	request := apiDryRunRulesRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, 400, "bad data")
+		return
+	}
+
+	if request.URL == "" {
+		writeJSONError(w, 422, "missing \"url\" value")
+		return
+	}
+
+	if request.Tags == nil {
+		request.Tags = []string{}
+	}
+
+	info, _, err := fetchInfo(r.Context(), ytdlwrapper.Make(), directdownload.Make(), request.URL)
+	if err != nil {
+		writeJSONError(w, 502, "failed fetching info: "+err.Error())
+		return
+	}
+
+	if info.IsPlaylist {
+		writeJSONError(w, 422, "URL is a playlist, rules can only be tried against single videos")
+		return
+	}
+
+	jobData := &creamqueue.JobData{
+		URL:         request.URL,
+		Tags:        tagNormalizer.Tags(request.Tags),
+		SubmittedBy: requestUser(r),
+	}
+	tagsBefore := importTags(jobData, &info.Entry)
+	result := tagRules.Apply(&info.Entry, tagsBefore)
+	formatProfile, _ := pickFormatProfile("", result.FormatProfile)
+
+	writeJSON(w, 200, struct {
+		Title         string   `json:"title"`
+		Extractor     string   `json:"extractor"`
+		ChannelID     string   `json:"channel_id"`
+		UploaderID    string   `json:"uploader_id"`
+		Duration      float64  `json:"duration"`
+		TagsBefore    []string `json:"tags_before"`
+		Rules         []string `json:"rules"`
+		Tags          []string `json:"tags"`
+		FormatProfile string   `json:"format_profile"`
+	}{
+		Title:         info.Entry.Title,
+		Extractor:     info.Entry.Extractor,
+		ChannelID:     info.Entry.ChannelID,
+		UploaderID:    info.Entry.UploaderID,
+		Duration:      info.Entry.Duration,
+		TagsBefore:    tagsBefore,
+		Rules:         result.Applied,
+		Tags:          result.Tags,
+		FormatProfile: formatProfile,
+	})
+}
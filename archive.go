@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+const localSourceArchive = "archive"
+
+// apiImportArchiveRequest is the JSON body accepted when importing a directory
+// of videos downloaded by yt-dlp with --write-info-json
+type apiImportArchiveRequest struct {
+	apiCreateJobRequest
+
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive"`
+}
+
+type archiveResult struct {
+	Path   string           `json:"path"`
+	URL    string           `json:"url,omitempty"`
+	ID     creamqueue.JobID `json:"id,omitempty"`
+	Reason string           `json:"reason,omitempty"`
+}
+
+type archiveSummary struct {
+	// BatchID is shared by the created jobs
+	BatchID    string          `json:"batch_id"`
+	Created    []archiveResult `json:"created"`
+	Duplicates []archiveResult `json:"duplicates"`
+	Rejected   []archiveResult `json:"rejected"`
+}
+
+// archiveJobData returns the job importing an archived video. The job gets the
+// URL yt-dlp downloaded the video from, so it ends up with the same tags,
+// title and description as if it was downloaded now.
+func archiveJobData(base creamqueue.JobData, video ytdlwrapper.ArchivedVideo, entry *ytdlwrapper.Entry) creamqueue.JobData {
+	data := base
+	data.Tags = append([]string{}, base.Tags...)
+	data.URL = entry.BestURL()
+	if data.URL == "" {
+		data.URL = localFileURL(video.MediaPath)
+	}
+	data.LocalPath = video.MediaPath
+	data.LocalInfoPath = video.InfoPath
+	data.LocalSource = localSourceArchive
+	return data
+}
+
+// queueArchive queues every archived video that isn't queued already
+func queueArchive(videos []ytdlwrapper.ArchivedVideo, base creamqueue.JobData) archiveSummary {
+	summary := archiveSummary{
+		BatchID:    string(idGenerator.Next()),
+		Created:    []archiveResult{},
+		Duplicates: []archiveResult{},
+		Rejected:   []archiveResult{},
+	}
+
+	seen := jobRepo.ActiveURLs()
+	for _, video := range videos {
+		result := archiveResult{Path: video.MediaPath}
+
+		entry, err := ytdlwrapper.ReadInfoFile(video.InfoPath)
+		if err != nil {
+			result.Reason = err.Error()
+			summary.Rejected = append(summary.Rejected, result)
+			continue
+		}
+
+		data := archiveJobData(base, video, entry)
+		data.BatchID = summary.BatchID
+		result.URL = data.URL
+
+		if seen[data.URL] {
+			result.Reason = "already queued"
+			summary.Duplicates = append(summary.Duplicates, result)
+			continue
+		}
+		seen[data.URL] = true
+
+		result.ID = queueJob(data)
+		summary.Created = append(summary.Created, result)
+	}
+
+	return summary
+}
+
+func handlerAPIImportArchive(w http.ResponseWriter, r *http.Request) {
+	// this reads any directory the importer can, so it's kept to admins
+	if !isAdmin(requestUser(r)) {
+		writeJSONError(w, 403, "only admins can import archives")
+		return
+	}
+
+	request := apiImportArchiveRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, 400, "bad data")
+		return
+	}
+
+	if request.Path == "" {
+		writeJSONError(w, 422, "missing \"path\" value")
+		return
+	}
+
+	if stat, err := os.Stat(request.Path); err != nil || !stat.IsDir() {
+		writeJSONError(w, 422, "\"path\" is not a directory")
+		return
+	}
+
+	base, err := request.jobData(r)
+	if err != nil {
+		writeJSONError(w, 422, err.Error())
+		return
+	}
+
+	videos, err := ytdlwrapper.FindArchived(request.Path, request.Recursive)
+	if err != nil {
+		writeJSONError(w, 500, "failed scanning directory: "+err.Error())
+		return
+	}
+
+	writeJSON(w, 200, queueArchive(videos, base))
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+// requestUser returns the name of the user making the request, as reported
+// by the authenticating reverse proxy in front of us.
+// If CREAMY_HTTP_USER_HEADER is not set, everybody is anonymous.
+func requestUser(r *http.Request) string {
+	if config.userHeader == "" {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(config.userHeader))
+}
+
+// isAdmin returns true if the user is allowed to see everyone's jobs.
+// Without authentication there is nobody to hide jobs from, so everybody is an admin.
+func isAdmin(user string) bool {
+	if config.userHeader == "" {
+		return true
+	}
+
+	for _, admin := range config.adminUsers {
+		if admin == user {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canSeeJob returns true if the job should be shown to the given user
+func canSeeJob(user string, onlyMine bool, job *jobInformation) bool {
+	if onlyMine || !isAdmin(user) {
+		return job.Data.SubmittedBy == user
+	}
+	return true
+}
+
+// canManageJob returns true if the user is allowed to change the job
+func canManageJob(user string, id creamqueue.JobID) bool {
+	allowed := false
+	jobRepo.View(id, func(job *jobInformation) {
+		allowed = canSeeJob(user, false, job)
+	})
+	return allowed
+}
+
+// requireUser rejects requests that did not pass through the authenticating proxy
+func requireUser(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.userHeader != "" && requestUser(r) == "" {
+			w.WriteHeader(401)
+			w.Write([]byte("missing \"" + config.userHeader + "\" header"))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+// maxBulkUploadSize is the largest list of URLs we accept in one go
+const maxBulkUploadSize = 10 << 20
+
+// bulkLine is a single job requested by a bulk import
+type bulkLine struct {
+	Line int
+	URL  string
+	Tags []string
+}
+
+// bulkLineResult describes what happened to a single line of a bulk import
+type bulkLineResult struct {
+	Line   int              `json:"line"`
+	URL    string           `json:"url"`
+	ID     creamqueue.JobID `json:"id,omitempty"`
+	Reason string           `json:"reason,omitempty"`
+}
+
+// bulkSummary is the outcome of a bulk import
+type bulkSummary struct {
+	// BatchID is shared by the created jobs
+	BatchID    string           `json:"batch_id"`
+	Created    []bulkLineResult `json:"created"`
+	Duplicates []bulkLineResult `json:"duplicates"`
+	Rejected   []bulkLineResult `json:"rejected"`
+}
+
+func splitTags(raw string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(raw, ",") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// parseBulkText reads one URL per line, optionally followed by whitespace
+// and comma-separated tags. Blank lines and lines starting with # are skipped.
+func parseBulkText(reader io.Reader) ([]bulkLine, []bulkLineResult, error) {
+	lines := []bulkLine{}
+	rejected := []bulkLineResult{}
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) > 2 {
+			rejected = append(rejected, bulkLineResult{
+				Line:   lineNumber,
+				URL:    fields[0],
+				Reason: "expected a URL, optionally followed by comma-separated tags without spaces",
+			})
+			continue
+		}
+
+		line := bulkLine{
+			Line: lineNumber,
+			URL:  fields[0],
+			Tags: []string{},
+		}
+		if len(fields) == 2 {
+			line.Tags = splitTags(fields[1])
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, rejected, scanner.Err()
+}
+
+// parseBulkCSV reads a URL from the first column and tags from the others.
+// A header row starting with "url" is skipped.
+func parseBulkCSV(reader io.Reader) ([]bulkLine, []bulkLineResult, error) {
+	lines := []bulkLine{}
+	rejected := []bulkLineResult{}
+
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rejected = append(rejected, bulkLineResult{
+					Line:   parseErr.Line,
+					Reason: parseErr.Err.Error(),
+				})
+				continue
+			}
+			return nil, nil, err
+		}
+
+		lineNumber, _ := csvReader.FieldPos(0)
+		url := strings.TrimSpace(record[0])
+		if url == "" || (lineNumber == 1 && strings.EqualFold(url, "url")) {
+			continue
+		}
+
+		tags := []string{}
+		for _, column := range record[1:] {
+			tags = append(tags, splitTags(column)...)
+		}
+
+		lines = append(lines, bulkLine{
+			Line: lineNumber,
+			URL:  url,
+			Tags: tags,
+		})
+	}
+
+	return lines, rejected, nil
+}
+
+// parseBulkJSONL reads one {"url": "...", "tags": ["..."]} object per line
+func parseBulkJSONL(reader io.Reader) ([]bulkLine, []bulkLineResult, error) {
+	lines := []bulkLine{}
+	rejected := []bulkLineResult{}
+
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		decoded := struct {
+			URL  string   `json:"url"`
+			Tags []string `json:"tags"`
+		}{}
+		if err := json.Unmarshal([]byte(text), &decoded); err != nil {
+			rejected = append(rejected, bulkLineResult{
+				Line:   lineNumber,
+				Reason: "invalid JSON: " + err.Error(),
+			})
+			continue
+		}
+
+		if decoded.Tags == nil {
+			decoded.Tags = []string{}
+		}
+		lines = append(lines, bulkLine{
+			Line: lineNumber,
+			URL:  strings.TrimSpace(decoded.URL),
+			Tags: decoded.Tags,
+		})
+	}
+
+	return lines, rejected, scanner.Err()
+}
+
+// parseBulk picks a parser based on the extension of the uploaded file
+func parseBulk(filename string, reader io.Reader) ([]bulkLine, []bulkLineResult, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		return parseBulkCSV(reader)
+	case ".jsonl", ".ndjson":
+		return parseBulkJSONL(reader)
+	}
+	return parseBulkText(reader)
+}
+
+func validateBulkURL(raw string) string {
+	if raw == "" {
+		return "missing URL"
+	}
+	parsed, err := neturl.Parse(raw)
+	if err != nil {
+		return "invalid URL: " + err.Error()
+	}
+	if parsed.Scheme == "" {
+		return "URL is not absolute"
+	}
+	return ""
+}
+
+// queueBulk queues every valid line as a normal job based on the shared template,
+// skipping URLs that were already submitted or are still being imported
+func queueBulk(lines []bulkLine, rejected []bulkLineResult, base creamqueue.JobData) bulkSummary {
+	summary := bulkSummary{
+		BatchID:    string(idGenerator.Next()),
+		Created:    []bulkLineResult{},
+		Duplicates: []bulkLineResult{},
+		Rejected:   rejected,
+	}
+
+	seen := jobRepo.ActiveURLs()
+	for _, line := range lines {
+		result := bulkLineResult{
+			Line: line.Line,
+			URL:  line.URL,
+		}
+
+		if reason := validateBulkURL(line.URL); reason != "" {
+			result.Reason = reason
+			summary.Rejected = append(summary.Rejected, result)
+			continue
+		}
+
+		if seen[line.URL] {
+			result.Reason = "already queued"
+			summary.Duplicates = append(summary.Duplicates, result)
+			continue
+		}
+		seen[line.URL] = true
+
+		data := base
+		data.URL = line.URL
+		data.BatchID = summary.BatchID
+		data.Tags = append(append([]string{}, base.Tags...), line.Tags...)
+		result.ID = queueJob(data)
+		summary.Created = append(summary.Created, result)
+	}
+
+	return summary
+}
+
+// bulkImportFromForm queues jobs from the "urls" textarea and the "file" upload
+func bulkImportFromForm(w http.ResponseWriter, r *http.Request) (bulkSummary, int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBulkUploadSize)
+	if err := r.ParseMultipartForm(maxBulkUploadSize); err != nil && err != http.ErrNotMultipart {
+		return bulkSummary{}, 400, errors.New("bad data")
+	}
+
+	base, err := jobDataFromForm(r)
+	if err != nil {
+		return bulkSummary{}, 422, err
+	}
+
+	lines, rejected, err := parseBulkText(strings.NewReader(r.FormValue("urls")))
+	if err != nil {
+		return bulkSummary{}, 400, err
+	}
+
+	file, header, err := r.FormFile("file")
+	if err == nil {
+		defer file.Close()
+		fileLines, fileRejected, err := parseBulk(header.Filename, file)
+		if err != nil {
+			return bulkSummary{}, 400, err
+		}
+		lines = append(lines, fileLines...)
+		rejected = append(rejected, fileRejected...)
+	} else if err != http.ErrMissingFile && err != http.ErrNotMultipart {
+		return bulkSummary{}, 400, err
+	}
+
+	if len(lines) == 0 && len(rejected) == 0 {
+		return bulkSummary{}, 422, errors.New("no URLs submitted")
+	}
+
+	return queueBulk(lines, rejected, base), 200, nil
+}
+
+var templateBulkSummary = template.Must(template.New("bulkSummary").Funcs(template.FuncMap{
+	"groupOf": groupOf,
+}).Parse(rawTemplateGroupActions + `
+<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="utf-8">
+		<title>Creamy Videos Importer</title>
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<style type="text/css">
+		html, body {
+			font-family: mono;
+			background-color: #1b1b1b;
+			color: #ababab;
+		}
+		a, a:visited {
+			color: mediumaquamarine;
+		}
+		.group-actions form { display: inline-block; margin-right: 1em; }
+		</style>
+	</head>
+	<body>
+		<p><a href="/">Back to jobs</a></p>
+
+		{{ if .Created }}
+			<p>Batch {{ .BatchID }}</p>
+			{{ template "groupActions" (groupOf "batch" .BatchID) }}
+		{{ end }}
+
+		<h2>Created: {{ len .Created }}</h2>
+		<ul>
+			{{ range .Created }}
+				<li>Line {{ .Line }}: {{ .URL }}</li>
+			{{ end }}
+		</ul>
+
+		<h2>Duplicates: {{ len .Duplicates }}</h2>
+		<ul>
+			{{ range .Duplicates }}
+				<li>Line {{ .Line }}: {{ .URL }} ({{ .Reason }})</li>
+			{{ end }}
+		</ul>
+
+		<h2>Rejected: {{ len .Rejected }}</h2>
+		<ul>
+			{{ range .Rejected }}
+				<li>Line {{ .Line }}: {{ .URL }} ({{ .Reason }})</li>
+			{{ end }}
+		</ul>
+	</body>
+</html>
+`))
+
+func handlerCreateJobsInBulk(w http.ResponseWriter, r *http.Request) {
+	summary, status, err := bulkImportFromForm(w, r)
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/html")
+	if err := templateBulkSummary.Execute(w, summary); err != nil {
+		log.Println("error rendering bulkSummary template:", err)
+	}
+}
+
+func handlerAPICreateJobsInBulk(w http.ResponseWriter, r *http.Request) {
+	summary, status, err := bulkImportFromForm(w, r)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, status, summary)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_parseBulk(t *testing.T) {
+	tests := []struct {
+		name         string
+		filename     string
+		input        string
+		wantLines    []bulkLine
+		wantRejected []bulkLineResult
+	}{
+		{
+			name:     "text",
+			filename: "urls.txt",
+			input:    "https://a.example.com/\n\n# comment\n  https://b.example.com/ food,food:korean\nhttps://c.example.com/ too many fields\n",
+			wantLines: []bulkLine{
+				{Line: 1, URL: "https://a.example.com/", Tags: []string{}},
+				{Line: 4, URL: "https://b.example.com/", Tags: []string{"food", "food:korean"}},
+			},
+			wantRejected: []bulkLineResult{
+				{Line: 5, URL: "https://c.example.com/", Reason: "expected a URL, optionally followed by comma-separated tags without spaces"},
+			},
+		},
+		{
+			name:     "csv",
+			filename: "urls.CSV",
+			input:    "url,tags\nhttps://a.example.com/\nhttps://b.example.com/,food,\"music,music:k-pop\"\n",
+			wantLines: []bulkLine{
+				{Line: 2, URL: "https://a.example.com/", Tags: []string{}},
+				{Line: 3, URL: "https://b.example.com/", Tags: []string{"food", "music", "music:k-pop"}},
+			},
+			wantRejected: []bulkLineResult{},
+		},
+		{
+			name:     "jsonl",
+			filename: "urls.jsonl",
+			input:    "{\"url\": \"https://a.example.com/\"}\n{\"url\": \"https://b.example.com/\", \"tags\": [\"food\"]}\nnot json\n",
+			wantLines: []bulkLine{
+				{Line: 1, URL: "https://a.example.com/", Tags: []string{}},
+				{Line: 2, URL: "https://b.example.com/", Tags: []string{"food"}},
+			},
+			wantRejected: []bulkLineResult{
+				{Line: 3, Reason: "invalid JSON: invalid character 'o' in literal null (expecting 'u')"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, rejected, err := parseBulk(tt.filename, strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("parseBulk() error = %v", err)
+			}
+			if !reflect.DeepEqual(lines, tt.wantLines) {
+				t.Errorf("parseBulk() lines = %v, want %v", lines, tt.wantLines)
+			}
+			if !reflect.DeepEqual(rejected, tt.wantRejected) {
+				t.Errorf("parseBulk() rejected = %v, want %v", rejected, tt.wantRejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/creamyvideos"
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+// chapterParentTag is shared by every chapter split from the same video
+func chapterParentTag(id creamqueue.JobID, entry *ytdlwrapper.Entry) string {
+	if entry.Extractor != "" && entry.ID != "" {
+		return fmt.Sprintf("chapters-of:%v-%v", entry.Extractor, entry.ID)
+	}
+	return "chapters-of:job-" + string(id)
+}
+
+// chapterArgs returns the ffmpeg arguments copying the chapter out of the input
+// without re-encoding it. Cuts land on the nearest keyframes.
+func chapterArgs(input string, chapter ytdlwrapper.Chapter, output string) []string {
+	seconds := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 3, 64)
+	}
+	return []string{
+		"-ss", seconds(chapter.StartTime),
+		"-i", input,
+		"-t", seconds(chapter.EndTime - chapter.StartTime),
+		"-map", "0",
+		"-c", "copy",
+		"-avoid_negative_ts", "make_zero",
+		output,
+	}
+}
+
+// uploadChapters splits the video into its chapters and uploads each of them
+// with the metadata rendered for it. Chapters uploaded by an earlier attempt of the job are skipped.
+func uploadChapters(ctx context.Context, job creamqueue.QueuedJob, entry *ytdlwrapper.Entry, file string, tags []string, chapters []videoMetadata, attachments []creamyvideos.Attachment) (*creamqueue.JobResult, error) {
+	jobData := job.Data()
+	wrapper := ffmpegwrapper.Make()
+
+	parentTag := chapterParentTag(job.ID(), entry)
+
+	// subtitle timings would be off for every chapter but the first
+	chapterAttachments := []creamyvideos.Attachment{}
+	for _, attachment := range attachments {
+		if attachment.FieldName != creamyvideos.FieldSubtitles {
+			chapterAttachments = append(chapterAttachments, attachment)
+		}
+	}
+
+	result := &creamqueue.JobResult{}
+	count := len(entry.Chapters)
+
+	for i, chapter := range entry.Chapters {
+		if i < len(jobData.UploadedChapters) {
+			continue
+		}
+
+		output := fmt.Sprintf("%v.chapter%v%v", job.ID(), i+1, filepath.Ext(file))
+		os.Remove(output)
+
+		job.Progress(creamqueue.JobProgress(fmt.Sprintf("Splitting chapter %v/%v", i+1, count)))
+		noProgress := func(*ffmpegwrapper.Progress) {}
+		if err := wrapper.RunWithProgress(ctx, noProgress, chapterArgs(file, chapter, output)...); err != nil {
+			os.Remove(output)
+			return nil, fmt.Errorf("failed splitting chapter %v after uploading %v: %w", i+1, i, err)
+		}
+
+		chapterTags := append(append([]string{}, tags...), parentTag, "chapter:"+strconv.Itoa(i+1))
+		uploaded, err := uploadVideo(job, fmt.Sprintf("Upload of chapter %v/%v", i+1, count), output, chapters[i].Title, chapters[i].Description, chapterTags, chapterAttachments)
+		os.Remove(output)
+		if err != nil {
+			return nil, fmt.Errorf("failed uploading chapter %v after uploading %v: %w", i+1, i, err)
+		}
+
+		// the job's data is kept between attempts
+		jobData.UploadedChapters = append(jobData.UploadedChapters, uploaded.URL)
+	}
+	result.CreamyURL = jobData.UploadedChapters[0]
+
+	name := entry.Title
+	if name == "" {
+		name = jobData.URL
+	}
+	result.Title = fmt.Sprintf("%v (%v chapters)", name, count)
+	return result, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+// testQueuedJob is a running job that isn't in any queue
+type testQueuedJob struct {
+	id   creamqueue.JobID
+	data creamqueue.JobData
+}
+
+func (job *testQueuedJob) ID() creamqueue.JobID                     { return job.id }
+func (job *testQueuedJob) Data() *creamqueue.JobData                { return &job.data }
+func (job *testQueuedJob) Progress(progress creamqueue.JobProgress) {}
+func (job *testQueuedJob) Finished(result *creamqueue.JobResult)    {}
+func (job *testQueuedJob) Failed(failure *creamqueue.JobFailure)    {}
+
+func Test_uploadChapters_retry(t *testing.T) {
+	useTestTagging(t)
+
+	directory := t.TempDir()
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(directory); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(workingDirectory)
+	})
+
+	// stands in for ffmpeg by writing the output file, its last argument
+	ffmpeg := filepath.Join(directory, "ffmpeg")
+	script := "#!/bin/sh\nfor output; do :; done\necho chapter > \"$output\"\necho progress=end\n"
+	if err := ioutil.WriteFile(ffmpeg, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("CREAMY_FFMPEG_BIN_PATH", ffmpeg)
+	t.Cleanup(func() {
+		os.Unsetenv("CREAMY_FFMPEG_BIN_PATH")
+	})
+
+	entry := &ytdlwrapper.Entry{
+		Title: "Album",
+		Chapters: []ytdlwrapper.Chapter{
+			{StartTime: 0, EndTime: 10, Title: "One"},
+			{StartTime: 10, EndTime: 20, Title: "Two"},
+			{StartTime: 20, EndTime: 30, Title: "Three"},
+		},
+	}
+	job := &testQueuedJob{
+		id:   "chapters",
+		data: creamqueue.JobData{URL: "https://example.com/album", TitleTemplate: "{{ .Chapter.Title }}", SplitChapters: true},
+	}
+	input := filepath.Join(directory, "album.mp4")
+	if err := ioutil.WriteFile(input, []byte("album"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second chapter fails the first attempt
+	uploads := []string{}
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title := r.FormValue("title")
+		if title == "Two" && !failed {
+			failed = true
+			w.Write([]byte("broken"))
+			return
+		}
+		uploads = append(uploads, title)
+		fmt.Fprintf(w, `{"id": %v}`, len(uploads))
+	}))
+	defer server.Close()
+	config.creamyVideosHost = server.URL
+
+	metadata, err := buildImportMetadata(&job.data, entry, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt := func() (*creamqueue.JobResult, error) {
+		return uploadChapters(context.Background(), job, entry, input, []string{}, metadata.Chapters, nil)
+	}
+	if _, err := attempt(); err == nil {
+		t.Fatal("first attempt succeeded, want it to fail on the second chapter")
+	}
+	result, err := attempt()
+	if err != nil {
+		t.Fatalf("second attempt failed: %v", err)
+	}
+
+	if want := []string{"One", "Two", "Three"}; !reflect.DeepEqual(uploads, want) {
+		t.Errorf("uploaded %v, want %v", uploads, want)
+	}
+	if want := server.URL + "/watch/1"; result.CreamyURL != want {
+		t.Errorf("CreamyURL = %v, want %v", result.CreamyURL, want)
+	}
+}
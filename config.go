@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/tagrules"
+)
+
+// fileConfig is the optional JSON file pointed to by CREAMY_CONFIG_FILE
+type fileConfig struct {
+	Rules            []tagrules.Rule          `json:"rules"`
+	MetadataTags     tagrules.MetadataMapping `json:"metadata_tags"`
+	TagNormalization tagrules.Normalization   `json:"tag_normalization"`
+
+	TitleTemplate       string `json:"title_template"`
+	DescriptionTemplate string `json:"description_template"`
+
+	FormatProfiles       map[string]formatProfile `json:"format_profiles"`
+	DefaultFormatProfile string                   `json:"default_format_profile"`
+
+	RecodeProfiles       map[string]recodeProfile `json:"recode_profiles"`
+	DefaultRecodeProfile string                   `json:"default_recode_profile"`
+
+	Subtitles subtitleConfig `json:"subtitles"`
+
+	WatchFolders []watchFolder `json:"watch_folders"`
+}
+
+func loadConfigFile(path string) (*fileConfig, error) {
+	loaded := &fileConfig{
+		Rules:                []tagrules.Rule{},
+		TitleTemplate:        defaultTitleTemplate,
+		DescriptionTemplate:  defaultDescriptionTemplate,
+		FormatProfiles:       map[string]formatProfile{},
+		DefaultFormatProfile: defaultFormatProfileName,
+		RecodeProfiles:       map[string]recodeProfile{},
+		DefaultRecodeProfile: noRecodeProfileName,
+		WatchFolders:         []watchFolder{},
+		Subtitles: subtitleConfig{
+			Languages: []string{},
+			Mode:      subtitleModeUpload,
+		},
+	}
+	if path == "" {
+		return loaded, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(loaded); err != nil {
+		return nil, err
+	}
+
+	return loaded, nil
+}
@@ -2,7 +2,6 @@ package creamqueue
 
 import (
 	"context"
-	"sync"
 )
 
 type barebonesJob struct {
@@ -38,69 +37,26 @@ func (job *barebonesJob) Failed(failure *JobFailure) {
 }
 
 type barebonesQueue struct {
+	handlers
+
 	jobs         chan *barebonesJob
 	priorityJobs chan *barebonesJob
-
-	handlerLock      sync.Locker
-	queuedHandlers   []OnQueuedHandler
-	startedHandlers  []OnStartedHandler
-	progressHandlers []OnProgressHandler
-	finishedHandlers []OnFinishedHandler
-	failedHanders    []OnFailedHandler
-}
-
-func (queue *barebonesQueue) OnQueued(handler OnQueuedHandler) {
-	queue.handlerLock.Lock()
-	queue.queuedHandlers = append(queue.queuedHandlers, handler)
-	queue.handlerLock.Unlock()
 }
 
 func (queue *barebonesQueue) triggerQueued(job *barebonesJob) {
-	for _, handler := range queue.queuedHandlers {
-		handler(job.id, *job.data)
-	}
-}
-
-func (queue *barebonesQueue) OnStarted(handler OnStartedHandler) {
-	queue.handlerLock.Lock()
-	queue.startedHandlers = append(queue.startedHandlers, handler)
-	queue.handlerLock.Unlock()
+	queue.notifyQueued(job.id, *job.data)
 }
 
 func (queue *barebonesQueue) triggerStarted(job *barebonesJob) {
-	for _, handler := range queue.startedHandlers {
-		handler(job.id, *job.data)
-	}
-}
-
-func (queue *barebonesQueue) OnProgress(handler OnProgressHandler) {
-	queue.handlerLock.Lock()
-	queue.progressHandlers = append(queue.progressHandlers, handler)
-	queue.handlerLock.Unlock()
+	queue.notifyStarted(job.id, *job.data)
 }
 
 func (queue *barebonesQueue) triggerProgress(job *barebonesJob, progress JobProgress) {
-	for _, handler := range queue.progressHandlers {
-		handler(job.id, *job.data, progress)
-	}
-}
-
-func (queue *barebonesQueue) OnFinished(handler OnFinishedHandler) {
-	queue.handlerLock.Lock()
-	queue.finishedHandlers = append(queue.finishedHandlers, handler)
-	queue.handlerLock.Unlock()
+	queue.notifyProgress(job.id, *job.data, progress)
 }
 
 func (queue *barebonesQueue) triggerFinished(job *barebonesJob, result *JobResult) {
-	for _, handler := range queue.finishedHandlers {
-		handler(job.id, *job.data, *result)
-	}
-}
-
-func (queue *barebonesQueue) OnFailed(handler OnFailedHandler) {
-	queue.handlerLock.Lock()
-	queue.failedHanders = append(queue.failedHanders, handler)
-	queue.handlerLock.Unlock()
+	queue.notifyFinished(job.id, *job.data, *result)
 }
 
 func (queue *barebonesQueue) triggerFailed(job *barebonesJob, failure *JobFailure) {
@@ -111,9 +67,7 @@ func (queue *barebonesQueue) triggerFailed(job *barebonesJob, failure *JobFailur
 		return
 	}
 
-	for _, handler := range queue.failedHanders {
-		handler(job.id, *job.data, job.failures)
-	}
+	queue.notifyFailed(job.id, *job.data, job.failures)
 }
 
 func (queue *barebonesQueue) pushToQueue(job *barebonesJob) {
@@ -146,7 +100,8 @@ func (queue *barebonesQueue) Pull(ctx context.Context) QueuedJob {
 	select {
 	case <-ctx.Done():
 		return nil
-	// prefer the priority queue:
+	// note: select picks randomly between ready cases, so this does not
+	// actually prefer the priority queue. See MakeHeapQueue for that.
 	case job = <-queue.priorityJobs:
 		break
 	case job = <-queue.jobs:
@@ -162,15 +117,11 @@ func (queue *barebonesQueue) Pull(ctx context.Context) QueuedJob {
 }
 
 // MakeBarebonesQueue returns a perfectly valid and working Queue instance :^)
+// It ignores priorities, groups and scheduling.
 func MakeBarebonesQueue() Queue {
 	return &barebonesQueue{
-		jobs:             make(chan *barebonesJob),
-		priorityJobs:     make(chan *barebonesJob),
-		handlerLock:      &sync.Mutex{},
-		queuedHandlers:   []OnQueuedHandler{},
-		startedHandlers:  []OnStartedHandler{},
-		progressHandlers: []OnProgressHandler{},
-		finishedHandlers: []OnFinishedHandler{},
-		failedHanders:    []OnFailedHandler{},
+		handlers:     makeHandlers(),
+		jobs:         make(chan *barebonesJob),
+		priorityJobs: make(chan *barebonesJob),
 	}
 }
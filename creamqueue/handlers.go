@@ -0,0 +1,115 @@
+package creamqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// handlers keeps track of event handlers registered on a queue
+type handlers struct {
+	handlerLock       sync.Locker
+	queuedHandlers    []OnQueuedHandler
+	scheduledHandlers []OnScheduledHandler
+	releasedHandlers  []OnReleasedHandler
+	startedHandlers   []OnStartedHandler
+	progressHandlers  []OnProgressHandler
+	finishedHandlers  []OnFinishedHandler
+	failedHanders     []OnFailedHandler
+}
+
+func makeHandlers() handlers {
+	return handlers{
+		handlerLock:       &sync.Mutex{},
+		queuedHandlers:    []OnQueuedHandler{},
+		scheduledHandlers: []OnScheduledHandler{},
+		releasedHandlers:  []OnReleasedHandler{},
+		startedHandlers:   []OnStartedHandler{},
+		progressHandlers:  []OnProgressHandler{},
+		finishedHandlers:  []OnFinishedHandler{},
+		failedHanders:     []OnFailedHandler{},
+	}
+}
+
+func (h *handlers) OnQueued(handler OnQueuedHandler) {
+	h.handlerLock.Lock()
+	h.queuedHandlers = append(h.queuedHandlers, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyQueued(id JobID, data JobData) {
+	for _, handler := range h.queuedHandlers {
+		handler(id, data)
+	}
+}
+
+func (h *handlers) OnScheduled(handler OnScheduledHandler) {
+	h.handlerLock.Lock()
+	h.scheduledHandlers = append(h.scheduledHandlers, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyScheduled(id JobID, data JobData, until time.Time) {
+	for _, handler := range h.scheduledHandlers {
+		handler(id, data, until)
+	}
+}
+
+func (h *handlers) OnReleased(handler OnReleasedHandler) {
+	h.handlerLock.Lock()
+	h.releasedHandlers = append(h.releasedHandlers, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyReleased(id JobID, data JobData) {
+	for _, handler := range h.releasedHandlers {
+		handler(id, data)
+	}
+}
+
+func (h *handlers) OnStarted(handler OnStartedHandler) {
+	h.handlerLock.Lock()
+	h.startedHandlers = append(h.startedHandlers, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyStarted(id JobID, data JobData) {
+	for _, handler := range h.startedHandlers {
+		handler(id, data)
+	}
+}
+
+func (h *handlers) OnProgress(handler OnProgressHandler) {
+	h.handlerLock.Lock()
+	h.progressHandlers = append(h.progressHandlers, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyProgress(id JobID, data JobData, progress JobProgress) {
+	for _, handler := range h.progressHandlers {
+		handler(id, data, progress)
+	}
+}
+
+func (h *handlers) OnFinished(handler OnFinishedHandler) {
+	h.handlerLock.Lock()
+	h.finishedHandlers = append(h.finishedHandlers, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyFinished(id JobID, data JobData, result JobResult) {
+	for _, handler := range h.finishedHandlers {
+		handler(id, data, result)
+	}
+}
+
+func (h *handlers) OnFailed(handler OnFailedHandler) {
+	h.handlerLock.Lock()
+	h.failedHanders = append(h.failedHanders, handler)
+	h.handlerLock.Unlock()
+}
+
+func (h *handlers) notifyFailed(id JobID, data JobData, failures []JobFailure) {
+	for _, handler := range h.failedHanders {
+		handler(id, data, failures)
+	}
+}
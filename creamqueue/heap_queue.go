@@ -0,0 +1,390 @@
+package creamqueue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+type heapJob struct {
+	id    JobID
+	queue *heapQueue
+
+	attempts         uint
+	maxAttempts      uint
+	previouslyPulled bool
+	failures         []JobFailure
+
+	data *JobData
+
+	// sequence is the order the job was first pushed in.
+	// Retried jobs keep their sequence, so they go back to the front of their priority.
+	sequence uint64
+	// group is the FairnessGroup the job was added to
+	group string
+	// index is the position of the job in its group's heap
+	index int
+}
+
+func (job *heapJob) ID() JobID {
+	return job.id
+}
+
+func (job *heapJob) Data() *JobData {
+	return job.data
+}
+
+func (job *heapJob) Progress(progress JobProgress) {
+	go job.queue.notifyProgress(job.id, *job.data, progress)
+}
+
+func (job *heapJob) Finished(result *JobResult) {
+	go job.queue.notifyFinished(job.id, *job.data, *result)
+}
+
+func (job *heapJob) Failed(failure *JobFailure) {
+	go job.queue.triggerFailed(job, failure)
+}
+
+// jobHeap orders jobs by priority, then by the order they were pushed in
+type jobHeap []*heapJob
+
+func (h jobHeap) Len() int {
+	return len(h)
+}
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].data.Priority != h[j].data.Priority {
+		return h[i].data.Priority > h[j].data.Priority
+	}
+	return h[i].sequence < h[j].sequence
+}
+
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x interface{}) {
+	job := x.(*heapJob)
+	job.index = len(*h)
+	*h = append(*h, job)
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	job := old[n-1]
+	old[n-1] = nil
+	job.index = -1
+	*h = old[:n-1]
+	return job
+}
+
+// jobGroup is a set of waiting jobs sharing the same FairnessGroup
+type jobGroup struct {
+	key     string
+	waiting jobHeap
+}
+
+type heapQueue struct {
+	handlers
+
+	lock     sync.Mutex
+	groups   map[string]*jobGroup
+	byID     map[JobID]*heapJob
+	sequence uint64
+
+	// groupOrder is the round-robin order of groups with waiting jobs,
+	// cursor is the index of the group that was served last
+	groupOrder []string
+	cursor     int
+
+	// scheduled jobs are held back by their NotBefore time or the download windows
+	scheduled map[JobID]*heapJob
+	windows   []DownloadWindow
+	now       func() time.Time
+
+	// wake is closed and replaced every time a job becomes available
+	wake chan struct{}
+}
+
+func (queue *heapQueue) triggerFailed(job *heapJob, failure *JobFailure) {
+	if job.attempts < job.maxAttempts {
+		job.attempts++
+		job.failures = append(job.failures, *failure)
+		queue.lock.Lock()
+		queue.add(job)
+		queue.lock.Unlock()
+		return
+	}
+
+	queue.notifyFailed(job.id, *job.data, job.failures)
+}
+
+// add a job to its group and wake up waiting pullers, queue.lock must be held
+func (queue *heapQueue) add(job *heapJob) {
+	key := job.data.FairnessGroup()
+	group, ok := queue.groups[key]
+	if !ok {
+		group = &jobGroup{
+			key:     key,
+			waiting: jobHeap{},
+		}
+		queue.groups[key] = group
+		queue.groupOrder = append(queue.groupOrder, key)
+	}
+
+	job.group = key
+	heap.Push(&group.waiting, job)
+	queue.byID[job.id] = job
+
+	queue.wakeUp()
+}
+
+// wakeUp all pullers so they look at the queue again, queue.lock must be held
+func (queue *heapQueue) wakeUp() {
+	close(queue.wake)
+	queue.wake = make(chan struct{})
+}
+
+// refresh moves jobs between waiting and scheduled depending on if they may start now,
+// returning the next time this has to happen again. queue.lock must be held,
+// so other pullers can't see the jobs before their handlers have been notified.
+func (queue *heapQueue) refresh() time.Time {
+	now := queue.now()
+	next := time.Time{}
+
+	consider := func(change time.Time) {
+		if !change.IsZero() && (next.IsZero() || change.Before(next)) {
+			next = change
+		}
+	}
+
+	for id, job := range queue.scheduled {
+		eligible, change := eligibility(job.data, queue.windows, now)
+		consider(change)
+		if !eligible {
+			continue
+		}
+
+		delete(queue.scheduled, id)
+		queue.add(job)
+		if !job.previouslyPulled {
+			queue.notifyReleased(id, *job.data)
+		}
+	}
+
+	for id, job := range queue.byID {
+		if !job.data.InDownloadWindow {
+			continue
+		}
+
+		eligible, change := eligibility(job.data, queue.windows, now)
+		consider(change)
+		if eligible {
+			continue
+		}
+
+		// the download window closed before the job could start
+		queue.remove(job)
+		queue.scheduled[id] = job
+		if !job.previouslyPulled {
+			queue.notifyScheduled(id, *job.data, change)
+		}
+	}
+
+	return next
+}
+
+// remove a waiting job from its group, queue.lock must be held
+func (queue *heapQueue) remove(job *heapJob) {
+	group := queue.groups[job.group]
+	heap.Remove(&group.waiting, job.index)
+	delete(queue.byID, job.id)
+
+	if group.waiting.Len() > 0 {
+		return
+	}
+
+	delete(queue.groups, group.key)
+	for i, key := range queue.groupOrder {
+		if key != group.key {
+			continue
+		}
+		queue.groupOrder = append(queue.groupOrder[:i], queue.groupOrder[i+1:]...)
+		if i <= queue.cursor {
+			// keep pointing at the group served last, or just before the removed one
+			queue.cursor--
+		}
+		break
+	}
+}
+
+// next picks the waiting job with the highest priority, taking turns between
+// groups when several have jobs of that priority. queue.lock must be held.
+func (queue *heapQueue) next() *heapJob {
+	var best *heapJob
+	bestIndex := 0
+
+	count := len(queue.groupOrder)
+	for offset := 1; offset <= count; offset++ {
+		i := (queue.cursor + offset) % count
+		head := queue.groups[queue.groupOrder[i]].waiting[0]
+		if best == nil || head.data.Priority > best.data.Priority {
+			best = head
+			bestIndex = i
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+
+	queue.cursor = bestIndex
+	queue.remove(best)
+	return best
+}
+
+func (queue *heapQueue) Push(id JobID, data JobData) {
+	queue.lock.Lock()
+	job := &heapJob{
+		id:    id,
+		queue: queue,
+
+		attempts:    0,
+		maxAttempts: 2,
+		failures:    []JobFailure{},
+
+		data:     &data,
+		sequence: queue.sequence,
+	}
+	queue.sequence++
+	queue.lock.Unlock()
+
+	queue.notifyQueued(job.id, *job.data)
+
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	eligible, until := eligibility(job.data, queue.windows, queue.now())
+	if eligible {
+		queue.add(job)
+		return
+	}
+
+	queue.scheduled[id] = job
+	// notified before the lock is released, a refresh could release the job right after
+	queue.notifyScheduled(job.id, *job.data, until)
+	// pullers might have to wake up earlier now
+	queue.wakeUp()
+}
+
+func (queue *heapQueue) Pull(ctx context.Context) QueuedJob {
+	for {
+		queue.lock.Lock()
+		nextRefresh := queue.refresh()
+		job := queue.next()
+		if job != nil && !job.previouslyPulled {
+			queue.notifyStarted(job.id, *job.data)
+			job.previouslyPulled = true
+		}
+		wake := queue.wake
+		queue.lock.Unlock()
+
+		if job != nil {
+			return job
+		}
+
+		var timer *time.Timer
+		var refreshTimer <-chan time.Time
+		if !nextRefresh.IsZero() {
+			timer = time.NewTimer(nextRefresh.Sub(queue.now()))
+			refreshTimer = timer.C
+		}
+
+		cancelled := false
+		select {
+		case <-ctx.Done():
+			cancelled = true
+		case <-wake:
+		case <-refreshTimer:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if cancelled {
+			return nil
+		}
+	}
+}
+
+func (queue *heapQueue) UpdateWaiting(id JobID, updater func(data *JobData)) (JobData, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if job, ok := queue.scheduled[id]; ok {
+		updater(job.data)
+		// the time this job is eligible might have changed
+		queue.wakeUp()
+		return *job.data, true
+	}
+
+	job, ok := queue.byID[id]
+	if !ok {
+		return JobData{}, false
+	}
+
+	// the update might move the job to another group, so take it out and put it back in
+	queue.remove(job)
+	updater(job.data)
+	queue.add(job)
+
+	return *job.data, true
+}
+
+func (queue *heapQueue) RemoveWaiting(id JobID) (JobData, bool) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	if job, ok := queue.scheduled[id]; ok {
+		delete(queue.scheduled, id)
+		return *job.data, true
+	}
+
+	job, ok := queue.byID[id]
+	if !ok {
+		return JobData{}, false
+	}
+
+	queue.remove(job)
+	return *job.data, true
+}
+
+// MakeHeapQueue returns a Queue that always hands out the job with the
+// highest priority first. Jobs of the same priority are handed out fairly:
+// the queue takes turns between groups of jobs (see JobData.FairnessGroup),
+// and jobs within a group leave in the order they were pushed.
+// Failed jobs are retried before other jobs of the same priority and group.
+//
+// Jobs are held back in a scheduled state until their NotBefore time, and jobs
+// asking for it only start inside one of the given download windows.
+//
+// Scheduled, released and started handlers are called while the queue is locked,
+// so the status they see can't be overtaken by another worker. They must not use the queue.
+func MakeHeapQueue(windows []DownloadWindow) MutableQueue {
+	return &heapQueue{
+		handlers:   makeHandlers(),
+		groups:     map[string]*jobGroup{},
+		byID:       map[JobID]*heapJob{},
+		groupOrder: []string{},
+		cursor:     -1,
+		scheduled:  map[JobID]*heapJob{},
+		windows:    windows,
+		now:        time.Now,
+		wake:       make(chan struct{}),
+	}
+}
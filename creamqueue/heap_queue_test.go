@@ -0,0 +1,222 @@
+package creamqueue
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func pullIDs(queue Queue, count int) []JobID {
+	ids := []JobID{}
+	for i := 0; i < count; i++ {
+		ids = append(ids, queue.Pull(context.Background()).ID())
+	}
+	return ids
+}
+
+func Test_heapQueue_Pull(t *testing.T) {
+	type push struct {
+		id       JobID
+		priority JobPriority
+	}
+	tests := []struct {
+		name   string
+		pushes []push
+		want   []JobID
+	}{
+		{
+			name: "fifo",
+			pushes: []push{
+				{"a", PriorityNormal},
+				{"b", PriorityNormal},
+				{"c", PriorityNormal},
+			},
+			want: []JobID{"a", "b", "c"},
+		},
+		{
+			name: "priority then fifo",
+			pushes: []push{
+				{"a", PriorityLow},
+				{"b", PriorityNormal},
+				{"c", PriorityHigh},
+				{"d", PriorityNormal},
+				{"e", PriorityHigh},
+				{"f", 3},
+			},
+			want: []JobID{"c", "e", "f", "b", "d", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := MakeHeapQueue(nil)
+			for _, push := range tt.pushes {
+				queue.Push(push.id, JobData{Priority: push.priority})
+			}
+			if got := pullIDs(queue, len(tt.want)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Pull() order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_heapQueue_Pull_fair(t *testing.T) {
+	queue := MakeHeapQueue(nil)
+	queue.Push("playlist-1", JobData{ParentPlaylistID: "big"})
+	queue.Push("playlist-2", JobData{ParentPlaylistID: "big"})
+	queue.Push("playlist-3", JobData{ParentPlaylistID: "big"})
+	queue.Push("playlist-4", JobData{ParentPlaylistID: "big"})
+	queue.Push("alice-1", JobData{SubmittedBy: "alice"})
+	queue.Push("bob-1", JobData{SubmittedBy: "bob"})
+	queue.Push("alice-2", JobData{SubmittedBy: "alice"})
+	queue.Push("batch-1", JobData{GroupKey: "batch", ParentPlaylistID: "big"})
+	queue.Push("urgent", JobData{ParentPlaylistID: "big", Priority: PriorityHigh})
+
+	// the playlist used its turn on the urgent job, so the others go next
+	want := []JobID{
+		"urgent",
+		"alice-1", "bob-1", "batch-1", "playlist-1",
+		"alice-2", "playlist-2",
+		"playlist-3",
+		"playlist-4",
+	}
+	if got := pullIDs(queue, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Pull() order = %v, want %v", got, want)
+	}
+}
+
+func Test_heapQueue_UpdateWaiting(t *testing.T) {
+	queue := MakeHeapQueue(nil)
+	queue.Push("a", JobData{})
+	queue.Push("b", JobData{})
+	queue.Push("c", JobData{})
+
+	if _, ok := queue.UpdateWaiting("c", func(data *JobData) { data.Priority = PriorityHigh }); !ok {
+		t.Fatal("UpdateWaiting() did not find waiting job c")
+	}
+
+	if got, want := pullIDs(queue, 1), []JobID{"c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pull() order = %v, want %v", got, want)
+	}
+
+	if _, ok := queue.UpdateWaiting("c", func(data *JobData) {}); ok {
+		t.Error("UpdateWaiting() changed job c after it was pulled")
+	}
+}
+
+func Test_heapQueue_RemoveWaiting(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	queue := MakeHeapQueue(nil).(*heapQueue)
+	queue.now = func() time.Time { return now }
+
+	queue.Push("a", JobData{})
+	queue.Push("b", JobData{})
+	queue.Push("later", JobData{NotBefore: now.Add(time.Hour)})
+
+	for _, id := range []JobID{"a", "later"} {
+		if _, ok := queue.RemoveWaiting(id); !ok {
+			t.Fatalf("RemoveWaiting() did not find waiting job %v", id)
+		}
+	}
+
+	if got, want := pullIDs(queue, 1), []JobID{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pull() order = %v, want %v", got, want)
+	}
+
+	if _, ok := queue.RemoveWaiting("b"); ok {
+		t.Error("RemoveWaiting() removed job b after it was pulled")
+	}
+
+	now = now.Add(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if job := queue.Pull(ctx); job != nil {
+		t.Errorf("Pull() = %v after it was removed, want nil", job.ID())
+	}
+}
+
+func Test_heapQueue_Pull_notBefore(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	queue := MakeHeapQueue(nil).(*heapQueue)
+	queue.now = func() time.Time { return now }
+
+	scheduled := []JobID{}
+	released := []JobID{}
+	queue.OnScheduled(func(id JobID, data JobData, until time.Time) { scheduled = append(scheduled, id) })
+	queue.OnReleased(func(id JobID, data JobData) { released = append(released, id) })
+
+	queue.Push("later", JobData{NotBefore: now.Add(time.Hour)})
+	queue.Push("now", JobData{})
+
+	if got, want := pullIDs(queue, 1), []JobID{"now"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pull() order = %v, want %v", got, want)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if job := queue.Pull(ctx); job != nil {
+		t.Errorf("Pull() = %v before its NotBefore time, want nil", job.ID())
+	}
+
+	now = now.Add(time.Hour)
+	if got, want := pullIDs(queue, 1), []JobID{"later"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Pull() order = %v, want %v", got, want)
+	}
+
+	if want := []JobID{"later"}; !reflect.DeepEqual(scheduled, want) || !reflect.DeepEqual(released, want) {
+		t.Errorf("scheduled = %v, released = %v, want %v for both", scheduled, released, want)
+	}
+}
+
+func Test_heapQueue_Pull_releasedBeforeStarted(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	queue := MakeHeapQueue(nil).(*heapQueue)
+	queue.now = func() time.Time { return now }
+
+	var lock sync.Mutex
+	events := []string{}
+	record := func(event string) {
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}
+
+	releasing := make(chan struct{})
+	var once sync.Once
+	queue.OnReleased(func(id JobID, data JobData) {
+		once.Do(func() { close(releasing) })
+		// another worker pulling the job now must not start it before this is done
+		time.Sleep(20 * time.Millisecond)
+		record("released " + string(id))
+	})
+	queue.OnStarted(func(id JobID, data JobData) { record("started " + string(id)) })
+
+	queue.Push("later", JobData{NotBefore: now.Add(time.Hour)})
+	queue.Push("urgent", JobData{NotBefore: now.Add(time.Hour), Priority: PriorityHigh})
+	now = now.Add(time.Hour)
+
+	pulled := make(chan JobID, 2)
+	go func() { pulled <- queue.Pull(context.Background()).ID() }()
+	<-releasing
+	go func() { pulled <- queue.Pull(context.Background()).ID() }()
+	<-pulled
+	<-pulled
+
+	lock.Lock()
+	defer lock.Unlock()
+	for _, id := range []string{"later", "urgent"} {
+		released, started := -1, -1
+		for i, event := range events {
+			switch event {
+			case "released " + id:
+				released = i
+			case "started " + id:
+				started = i
+			}
+		}
+		if released == -1 || started < released {
+			t.Errorf("%v was started before it was released: %v", id, events)
+		}
+	}
+}
@@ -1,10 +1,59 @@
 package creamqueue
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // JobID is a unique identifier for a job
 type JobID string
 
+// JobPriority decides which waiting job is pulled first. Higher goes first.
+type JobPriority int
+
+const (
+	// PriorityLow jobs wait until nothing else is waiting
+	PriorityLow JobPriority = -10
+	// PriorityNormal is the default priority
+	PriorityNormal JobPriority = 0
+	// PriorityHigh jobs jump ahead of everything else
+	PriorityHigh JobPriority = 10
+)
+
+func (priority JobPriority) String() string {
+	switch priority {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	}
+	return strconv.Itoa(int(priority))
+}
+
+// ParseJobPriority accepts "low", "normal", "high" or a number.
+// An empty string is PriorityNormal.
+func ParseJobPriority(raw string) (JobPriority, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "normal":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+
+	priority, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil {
+		return PriorityNormal, fmt.Errorf("unknown priority %q, expected low, normal, high or a number", raw)
+	}
+	return JobPriority(priority), nil
+}
+
 // JobData contains the arguments to begin processing our job
 type JobData struct {
 	URL  string
@@ -12,6 +61,112 @@ type JobData struct {
 
 	ParentPlaylistID        string
 	ParentPlaylistExtractor string
+	// PlaylistIndex is the 1-based position of this job's video in its parent playlist
+	PlaylistIndex int
+	PlaylistTitle string
+
+	// ParentJobID is the playlist job that queued this job
+	ParentJobID JobID
+	// BatchID is shared by the jobs queued together by a bulk or archive import
+	BatchID string
+	// PlaylistAncestry are the playlists this job was found in, outermost first.
+	// The last one is the parent playlist.
+	PlaylistAncestry []PlaylistRef
+
+	// SubmittedBy is the name of the user who queued the job, if known
+	SubmittedBy string
+
+	Priority JobPriority
+
+	// GroupKey explicitly sets the group this job is scheduled fairly within,
+	// see FairnessGroup
+	GroupKey string
+
+	// NotBefore holds the job back until the given time
+	NotBefore time.Time
+	// InDownloadWindow holds the job back until the queue's download windows allow it
+	InDownloadWindow bool
+
+	// TitleTemplate and DescriptionTemplate override the configured text/template
+	// strings used to build the video's title and description
+	TitleTemplate       string
+	DescriptionTemplate string
+
+	// FormatProfile names the yt-dlp format options to download with,
+	// empty to let the importer decide
+	FormatProfile string
+	// RecodeProfile names the ffmpeg post-processing to run after downloading,
+	// empty to let the importer decide
+	RecodeProfile string
+
+	// SubtitleLanguages overrides the configured subtitle languages, like ["en", "de"]
+	SubtitleLanguages []string
+	// AutoSubtitles also downloads automatically generated subtitles
+	AutoSubtitles bool
+
+	// SplitChapters uploads every chapter of the video as its own video
+	SplitChapters bool
+	// UploadedChapters are the URLs of the chapters uploaded by earlier attempts, in order.
+	// Retries skip them instead of uploading them again.
+	UploadedChapters []string
+
+	// LocalPath is a file on disk to import instead of downloading the URL
+	LocalPath string
+	// LocalSource says where LocalPath came from, like "watch-folder"
+	LocalSource string
+	// LocalInfoPath is the .info.json file yt-dlp wrote for LocalPath, if any
+	LocalInfoPath string
+
+	// Playlist picks which videos are queued if the URL turns out to be a playlist
+	Playlist PlaylistOptions
+}
+
+// A PlaylistRef identifies a playlist that was expanded into jobs
+type PlaylistRef struct {
+	ID        string
+	Extractor string
+	// URL is the address the playlist was expanded from
+	URL string
+}
+
+// PlaylistOptions pick which videos of a playlist are queued. Zero values don't filter.
+type PlaylistOptions struct {
+	// Items are 1-based positions and ranges, like "1-20,25,30-"
+	Items string `json:"items"`
+	// Last keeps only the last N videos
+	Last int `json:"last"`
+	// Reverse queues the videos starting from the end of the playlist
+	Reverse bool `json:"reverse"`
+
+	// DateAfter and DateBefore are inclusive YYYYMMDD upload dates.
+	// Videos with an unknown upload date are kept.
+	DateAfter  string `json:"date_after"`
+	DateBefore string `json:"date_before"`
+
+	// TitleInclude and TitleExclude are regular expressions matched against titles
+	TitleInclude string `json:"title_include"`
+	TitleExclude string `json:"title_exclude"`
+
+	// MinDuration and MaxDuration are in seconds.
+	// Videos with an unknown duration are kept.
+	MinDuration float64 `json:"min_duration"`
+	MaxDuration float64 `json:"max_duration"`
+
+	// Max caps how many videos are queued
+	Max int `json:"max"`
+}
+
+// FairnessGroup returns the group this job shares its turns with.
+// Jobs of the same priority are handed out round-robin between groups,
+// so a large playlist doesn't hold up everything queued after it.
+func (data *JobData) FairnessGroup() string {
+	if data.GroupKey != "" {
+		return "group:" + data.GroupKey
+	}
+	if data.ParentPlaylistID != "" {
+		return "playlist:" + data.ParentPlaylistExtractor + ":" + data.ParentPlaylistID
+	}
+	return "submitter:" + data.SubmittedBy
 }
 
 // JobProgress describes the current state of the job
@@ -41,6 +196,12 @@ type QueuedJob interface {
 // An OnQueuedHandler is called when a job is pushed to the queue
 type OnQueuedHandler func(id JobID, data JobData)
 
+// An OnScheduledHandler is called when a job has to wait until a later time before it can start
+type OnScheduledHandler func(id JobID, data JobData, until time.Time)
+
+// An OnReleasedHandler is called when a scheduled job is allowed to start
+type OnReleasedHandler func(id JobID, data JobData)
+
 // An OnStartedHandler is called when a job is started for the first time
 type OnStartedHandler func(id JobID, data JobData)
 
@@ -56,6 +217,8 @@ type OnFailedHandler func(id JobID, data JobData, failures []JobFailure)
 // A Queue handles your jobs
 type Queue interface {
 	OnQueued(handler OnQueuedHandler)
+	OnScheduled(handler OnScheduledHandler)
+	OnReleased(handler OnReleasedHandler)
 	OnStarted(handler OnStartedHandler)
 	OnProgress(handler OnProgressHandler)
 	OnFinished(handler OnFinishedHandler)
@@ -64,3 +227,16 @@ type Queue interface {
 	Push(id JobID, data JobData)
 	Pull(ctx context.Context) QueuedJob
 }
+
+// A MutableQueue allows changing jobs that are still waiting to be pulled
+type MutableQueue interface {
+	Queue
+
+	// UpdateWaiting changes the data of a job that has not been pulled yet.
+	// Returns false if the job is not waiting.
+	UpdateWaiting(id JobID, updater func(data *JobData)) (JobData, bool)
+
+	// RemoveWaiting takes a job that has not been pulled yet out of the queue,
+	// without notifying any handlers. Returns false if the job is not waiting.
+	RemoveWaiting(id JobID) (JobData, bool)
+}
@@ -0,0 +1,116 @@
+package creamqueue
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A DownloadWindow is a daily range of local time jobs are allowed to start in,
+// like 01:00-07:00. Windows may wrap past midnight, like 22:00-02:00.
+type DownloadWindow struct {
+	// Start and End are offsets from midnight
+	Start time.Duration
+	End   time.Duration
+}
+
+func (window DownloadWindow) String() string {
+	format := func(offset time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(offset.Hours()), int(offset.Minutes())%60)
+	}
+	return format(window.Start) + "-" + format(window.End)
+}
+
+func parseClock(raw string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(raw))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", raw)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// ParseDownloadWindows parses a comma-separated list of windows like "01:00-07:00,13:00-14:00"
+func ParseDownloadWindows(raw string) ([]DownloadWindow, error) {
+	windows := []DownloadWindow{}
+	for _, rawWindow := range strings.Split(raw, ",") {
+		if strings.TrimSpace(rawWindow) == "" {
+			continue
+		}
+
+		parts := strings.Split(rawWindow, "-")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid download window %q, expected HH:MM-HH:MM", rawWindow)
+		}
+
+		start, err := parseClock(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("download window %q is empty", rawWindow)
+		}
+
+		windows = append(windows, DownloadWindow{start, end})
+	}
+	return windows, nil
+}
+
+func midnight(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// nextWindowChange returns whether t is inside any of the windows, and the
+// next time that stops being true: the end of the current window, or the start
+// of the next one.
+func nextWindowChange(windows []DownloadWindow, t time.Time) (bool, time.Time) {
+	inside := false
+	next := time.Time{}
+	consider := func(candidate time.Time) {
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+
+	today := midnight(t)
+	for _, window := range windows {
+		// check the window starting yesterday too, in case it wraps past midnight
+		for _, day := range []time.Time{today.AddDate(0, 0, -1), today, today.AddDate(0, 0, 1)} {
+			start := day.Add(window.Start)
+			end := day.Add(window.End)
+			if window.End < window.Start {
+				end = day.AddDate(0, 0, 1).Add(window.End)
+			}
+
+			if !t.Before(start) && t.Before(end) {
+				if !inside {
+					next = time.Time{}
+				}
+				inside = true
+				consider(end)
+			} else if !inside && start.After(t) {
+				consider(start)
+			}
+		}
+	}
+
+	return inside, next
+}
+
+// eligibility returns whether the job may start at the given time,
+// and the next time that might change. A zero time means it never changes.
+func eligibility(data *JobData, windows []DownloadWindow, now time.Time) (bool, time.Time) {
+	if now.Before(data.NotBefore) {
+		return false, data.NotBefore
+	}
+
+	if !data.InDownloadWindow || len(windows) == 0 {
+		return true, time.Time{}
+	}
+
+	return nextWindowChange(windows, now)
+}
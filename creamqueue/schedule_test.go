@@ -0,0 +1,86 @@
+package creamqueue
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDownloadWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []DownloadWindow
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			raw:  "",
+			want: []DownloadWindow{},
+		},
+		{
+			name: "multiple",
+			raw:  "01:00-07:00, 22:30-02:15",
+			want: []DownloadWindow{
+				{time.Hour, 7 * time.Hour},
+				{22*time.Hour + 30*time.Minute, 2*time.Hour + 15*time.Minute},
+			},
+		},
+		{
+			name:    "missing end",
+			raw:     "01:00",
+			wantErr: true,
+		},
+		{
+			name:    "bad time",
+			raw:     "1am-7am",
+			wantErr: true,
+		},
+		{
+			name:    "empty window",
+			raw:     "01:00-01:00",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDownloadWindows(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseDownloadWindows() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDownloadWindows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_nextWindowChange(t *testing.T) {
+	windows, _ := ParseDownloadWindows("01:00-07:00,22:00-23:00,23:30-00:30")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name       string
+		t          time.Time
+		wantInside bool
+		wantNext   time.Time
+	}{
+		{"before first window", at(10, 0, 45), false, at(10, 1, 0)},
+		{"inside first window", at(10, 1, 0), true, at(10, 7, 0)},
+		{"after first window", at(10, 7, 0), false, at(10, 22, 0)},
+		{"between evening windows", at(10, 23, 10), false, at(10, 23, 30)},
+		{"inside window before midnight", at(10, 23, 45), true, at(11, 0, 30)},
+		{"inside window after midnight", at(11, 0, 15), true, at(11, 0, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inside, next := nextWindowChange(windows, tt.t)
+			if inside != tt.wantInside || !next.Equal(tt.wantNext) {
+				t.Errorf("nextWindowChange() = %v, %v, want %v, %v", inside, next, tt.wantInside, tt.wantNext)
+			}
+		})
+	}
+}
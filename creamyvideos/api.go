@@ -30,8 +30,29 @@ func point(host, path string) (string, error) {
 	return parsedHost.String(), nil
 }
 
+// An Attachment is an extra file sent along with the video, like its thumbnail
+type Attachment struct {
+	FieldName string
+	LocalPath string
+	// FileName is sent instead of the local file's name if set
+	FileName string
+}
+
+// FieldThumbnail is the multipart field creamy-videos reads thumbnails from
+const FieldThumbnail = "thumbnail"
+
+// FieldSubtitles is the multipart field creamy-videos reads WebVTT subtitles from,
+// named like "en.vtt"
+const FieldSubtitles = "subtitles"
+
 // UploadWithProgress uploads a local file to a creamy-videos server and provides progress updates
 func UploadWithProgress(host, localPath, title, description string, tags []string, callback func(current, total int64)) (*UploadResult, error) {
+	return UploadWithAttachments(host, localPath, title, description, tags, nil, callback)
+}
+
+// UploadWithAttachments uploads a local file and its attachments to a creamy-videos server
+// and provides progress updates
+func UploadWithAttachments(host, localPath, title, description string, tags []string, attachments []Attachment, callback func(current, total int64)) (*UploadResult, error) {
 	r := req.New()
 
 	url, err := point(host, pointUploadVideo)
@@ -45,6 +66,33 @@ func UploadWithProgress(host, localPath, title, description string, tags []strin
 	}
 	defer fileStream.Close()
 
+	uploads := []req.FileUpload{
+		{
+			File:      fileStream,
+			FieldName: "file",
+			FileName:  path.Base(localPath),
+		},
+	}
+
+	for _, attachment := range attachments {
+		attachmentStream, err := os.Open(attachment.LocalPath)
+		if err != nil {
+			return nil, err
+		}
+		defer attachmentStream.Close()
+
+		fileName := attachment.FileName
+		if fileName == "" {
+			fileName = path.Base(attachment.LocalPath)
+		}
+
+		uploads = append(uploads, req.FileUpload{
+			File:      attachmentStream,
+			FieldName: attachment.FieldName,
+			FileName:  fileName,
+		})
+	}
+
 	resp, err := r.Post(
 		url,
 		req.Param{
@@ -52,11 +100,7 @@ func UploadWithProgress(host, localPath, title, description string, tags []strin
 			"description": description,
 			"tags":        strings.Join(tags, ","),
 		},
-		req.FileUpload{
-			File:      fileStream,
-			FieldName: "file",
-			FileName:  path.Base(localPath),
-		},
+		uploads,
 		req.UploadProgress(callback),
 	)
 
@@ -0,0 +1,324 @@
+package directdownload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAttempts is how often an interrupted download is resumed before giving up
+const maxAttempts = 5
+
+// A Downloader fetches media files over plain HTTP
+type Downloader struct {
+	Client *http.Client
+	// RetryDelay is waited before resuming an interrupted download
+	RetryDelay time.Duration
+}
+
+// Info describes a direct media URL
+type Info struct {
+	URL         string
+	ContentType string
+	// Size is -1 if unknown
+	Size int64
+	// FileName comes from Content-Disposition, or the URL's path
+	FileName string
+	// AcceptsRanges is set if the server says it supports Range requests
+	AcceptsRanges bool
+}
+
+// Title returns the file name without its extension
+func (info *Info) Title() string {
+	return strings.TrimSuffix(info.FileName, path.Ext(info.FileName))
+}
+
+// Extension returns the file's extension including the dot, like ".mp4",
+// or an empty string if unknown
+func (info *Info) Extension() string {
+	if ext := cleanExtension(path.Ext(info.FileName)); ext != "" {
+		return ext
+	}
+	if extensions, _ := mime.ExtensionsByType(info.ContentType); len(extensions) > 0 {
+		return cleanExtension(extensions[0])
+	}
+	return ""
+}
+
+func cleanExtension(ext string) string {
+	if len(ext) < 2 || len(ext) > 6 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return strings.ToLower(ext)
+}
+
+var mediaExtensions = map[string]bool{
+	".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".mkv": true,
+	".avi": true, ".wmv": true, ".flv": true, ".mpg": true, ".mpeg": true,
+	".ts": true, ".ogv": true, ".3gp": true,
+	".mp3": true, ".m4a": true, ".ogg": true, ".opus": true, ".flac": true, ".wav": true,
+}
+
+// IsMedia returns true if the URL points at an audio or video file,
+// rather than a page for yt-dlp to look at
+func (info *Info) IsMedia() bool {
+	if strings.HasPrefix(info.ContentType, "video/") || strings.HasPrefix(info.ContentType, "audio/") {
+		return true
+	}
+	// some servers don't know better, so trust the extension
+	switch info.ContentType {
+	case "application/octet-stream", "binary/octet-stream", "":
+		return mediaExtensions[strings.ToLower(path.Ext(info.FileName))]
+	}
+	return false
+}
+
+// HasMediaExtension returns true if the path of the URL ends in the extension of
+// an audio or video file, so it is worth probing before asking yt-dlp about it
+func HasMediaExtension(rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return mediaExtensions[strings.ToLower(path.Ext(parsed.Path))]
+}
+
+// Probe sends a HEAD request to find out what the URL points at
+func (downloader *Downloader) Probe(ctx context.Context, rawURL string) (*Info, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := downloader.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("HEAD %v: unexpected status %v", rawURL, resp.Status)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	return &Info{
+		// redirects are followed, later requests can skip them
+		URL:           resp.Request.URL.String(),
+		ContentType:   contentType,
+		Size:          resp.ContentLength,
+		FileName:      fileName(resp),
+		AcceptsRanges: resp.Header.Get("Accept-Ranges") == "bytes",
+	}, nil
+}
+
+// fileName reads the name from Content-Disposition, falling back to the last
+// part of the URL's path
+func fileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := path.Base(strings.Replace(params["filename"], "\\", "/", -1)); name != "." && name != "/" {
+			return name
+		}
+	}
+
+	name, err := url.PathUnescape(path.Base(resp.Request.URL.Path))
+	if err != nil || name == "." || name == "/" {
+		return resp.Request.URL.Host
+	}
+	return name
+}
+
+// Progress of a download
+type Progress struct {
+	Downloaded uint64
+	// TotalSize is 0 if unknown
+	TotalSize uint64
+	// Speed is in bytes per second
+	Speed uint64
+}
+
+// Percent returns how much of the file was downloaded, or 0 if its size is unknown
+func (progress *Progress) Percent() float64 {
+	if progress.TotalSize == 0 {
+		return 0
+	}
+	return float64(progress.Downloaded) / float64(progress.TotalSize) * 100
+}
+
+// errRangeIgnored means the server sent the whole file instead of the requested range
+var errRangeIgnored = errors.New("range ignored")
+
+// Download the URL to the given path, resuming from <path>.part if it exists
+// and resuming again if the connection drops
+func (downloader *Downloader) Download(ctx context.Context, rawURL, destination string, callback func(*Progress)) error {
+	partPath := destination + ".part"
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = downloader.downloadAttempt(ctx, rawURL, partPath, callback)
+		if err == nil {
+			return os.Rename(partPath, destination)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(downloader.RetryDelay):
+		}
+	}
+
+	return fmt.Errorf("giving up after %v attempts: %w", maxAttempts, err)
+}
+
+func (downloader *Downloader) downloadAttempt(ctx context.Context, rawURL, partPath string, callback func(*Progress)) error {
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+	}
+
+	resp, err := downloader.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var total int64
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// no range asked for, or the server ignored it: start over
+		if offset > 0 {
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			if err := file.Truncate(0); err != nil {
+				return err
+			}
+			offset = 0
+		}
+		total = resp.ContentLength
+	case http.StatusPartialContent:
+		start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != offset {
+			return fmt.Errorf("%w: asked for %v, got %v", errRangeIgnored, offset, start)
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the part file is already complete
+		if _, size, err := parseContentRange(resp.Header.Get("Content-Range")); err == nil && size == offset {
+			return nil
+		}
+		return fmt.Errorf("GET %v: unexpected status %v", rawURL, resp.Status)
+	default:
+		return fmt.Errorf("GET %v: unexpected status %v", rawURL, resp.Status)
+	}
+
+	progress := &Progress{Downloaded: uint64(offset)}
+	if total > 0 {
+		progress.TotalSize = uint64(total)
+	}
+
+	started := time.Now()
+	buffer := make([]byte, 64*1024)
+	for {
+		n, readErr := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, err := file.Write(buffer[:n]); err != nil {
+				return err
+			}
+			progress.Downloaded += uint64(n)
+			if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+				progress.Speed = uint64(float64(progress.Downloaded-uint64(offset)) / elapsed)
+			}
+			callback(progress)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if progress.TotalSize > 0 && progress.Downloaded != progress.TotalSize {
+		return fmt.Errorf("download ended after %v of %v bytes", progress.Downloaded, progress.TotalSize)
+	}
+	return nil
+}
+
+// parseContentRange reads headers like "bytes 100-199/200" and "bytes */200".
+// size is -1 if unknown.
+func parseContentRange(header string) (start int64, size int64, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", header)
+
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, invalid
+	}
+	header = strings.TrimPrefix(header, "bytes ")
+
+	slash := strings.Index(header, "/")
+	if slash == -1 {
+		return 0, 0, invalid
+	}
+	rangePart, sizePart := header[:slash], header[slash+1:]
+
+	size = -1
+	if sizePart != "*" {
+		if size, err = strconv.ParseInt(sizePart, 10, 64); err != nil {
+			return 0, 0, invalid
+		}
+	}
+
+	if rangePart == "*" {
+		return 0, size, nil
+	}
+	dash := strings.Index(rangePart, "-")
+	if dash == -1 {
+		return 0, 0, invalid
+	}
+	if start, err = strconv.ParseInt(rangePart[:dash], 10, 64); err != nil {
+		return 0, 0, invalid
+	}
+	return start, size, nil
+}
+
+// Make a default instance of the downloader
+func Make() *Downloader {
+	return &Downloader{
+		Client:     http.DefaultClient,
+		RetryDelay: 5 * time.Second,
+	}
+}
@@ -0,0 +1,161 @@
+package directdownload
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var content = bytes.Repeat([]byte("0123456789"), 10000)
+
+func serveContent(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+}
+
+func TestDownloader_Probe(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "video/mp4")
+		w.Header().Set("Content-Disposition", `attachment; filename="Big Buck Bunny.mp4"`)
+		serveContent(w, r)
+	})
+	mux.HandleFunc("/files/Sintel Trailer.mkv", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		serveContent(w, r)
+	})
+	mux.HandleFunc("/watch", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html></html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tests := []struct {
+		path          string
+		wantMedia     bool
+		wantTitle     string
+		wantExtension string
+	}{
+		{"/download", true, "Big Buck Bunny", ".mp4"},
+		{"/files/Sintel%20Trailer.mkv", true, "Sintel Trailer", ".mkv"},
+		{"/watch", false, "watch", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			downloader := &Downloader{Client: server.Client()}
+			info, err := downloader.Probe(context.Background(), server.URL+tt.path)
+			if err != nil {
+				t.Fatalf("Probe() error = %v", err)
+			}
+			if got := info.IsMedia(); got != tt.wantMedia {
+				t.Errorf("IsMedia() = %v, want %v", got, tt.wantMedia)
+			}
+			if got := info.Title(); got != tt.wantTitle {
+				t.Errorf("Title() = %q, want %q", got, tt.wantTitle)
+			}
+			if got := info.Extension(); got != tt.wantExtension && tt.wantMedia {
+				t.Errorf("Extension() = %q, want %q", got, tt.wantExtension)
+			}
+			if tt.wantMedia && (info.Size != int64(len(content)) || !info.AcceptsRanges) {
+				t.Errorf("Probe() size = %v, accepts ranges = %v", info.Size, info.AcceptsRanges)
+			}
+		})
+	}
+}
+
+func TestDownloader_Download(t *testing.T) {
+	tests := []struct {
+		name       string
+		partial    []byte
+		dropAfter  int
+		wantRanges []string
+	}{
+		{"fresh", nil, 0, []string{""}},
+		{"resumes part file", content[:12345], 0, []string{"bytes=12345-"}},
+		{"resumes dropped connection", nil, 50000, []string{"", "bytes=50000-"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := sync.Mutex{}
+			ranges := []string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				ranges = append(ranges, r.Header.Get("Range"))
+				first := len(ranges) == 1
+				lock.Unlock()
+
+				if first && tt.dropAfter > 0 {
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+					w.Write(content[:tt.dropAfter])
+					panic(http.ErrAbortHandler)
+				}
+				serveContent(w, r)
+			}))
+			defer server.Close()
+
+			destination := filepath.Join(t.TempDir(), "1.mp4")
+			if tt.partial != nil {
+				if err := ioutil.WriteFile(destination+".part", tt.partial, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var last Progress
+			downloader := &Downloader{Client: server.Client()}
+			err := downloader.Download(context.Background(), server.URL, destination, func(progress *Progress) {
+				last = *progress
+			})
+			if err != nil {
+				t.Fatalf("Download() error = %v", err)
+			}
+
+			downloaded, err := ioutil.ReadFile(destination)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(downloaded, content) {
+				t.Errorf("Download() wrote %v bytes, want %v", len(downloaded), len(content))
+			}
+			if last.Percent() != 100 {
+				t.Errorf("Download() last progress = %+v", last)
+			}
+			if strings.Join(ranges, ",") != strings.Join(tt.wantRanges, ",") {
+				t.Errorf("Download() requested ranges %q, want %q", ranges, tt.wantRanges)
+			}
+		})
+	}
+}
+
+func Test_parseContentRange(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantStart int64
+		wantSize  int64
+		wantErr   bool
+	}{
+		{"bytes 100-199/200", 100, 200, false},
+		{"bytes 0-99/*", 0, -1, false},
+		{"bytes */200", 0, 200, false},
+		{"bytes 100/200", 0, 0, true},
+		{"items 0-1/2", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			start, size, err := parseContentRange(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseContentRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if start != tt.wantStart || size != tt.wantSize {
+				t.Errorf("parseContentRange() = %v, %v, want %v, %v", start, size, tt.wantStart, tt.wantSize)
+			}
+		})
+	}
+}
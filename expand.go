@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+// releaseLock keeps releases of the same playlist from pushing more children than its batch allows
+var releaseLock sync.Mutex
+
+// expandPlaylist stores the children of a playlist job and queues the first batch of them.
+// The rest are queued as the queued ones stop, see releaseChildren.
+func expandPlaylist(parentID creamqueue.JobID, children []creamqueue.JobData) {
+	jobRepo.Update(parentID, func(job *jobInformation) {
+		job.PendingChildren = append(job.PendingChildren, children...)
+	})
+	releaseChildren(parentID)
+}
+
+// releaseChildren queues pending children of the playlist job until
+// a batch of them is waiting or running
+func releaseChildren(parentID creamqueue.JobID) {
+	releaseLock.Lock()
+	defer releaseLock.Unlock()
+
+	for _, child := range jobRepo.TakePendingChildren(parentID, config.playlistBatchSize) {
+		queue.Push(idGenerator.Next(), child)
+	}
+}
+
+// TakePendingChildren removes and returns as many pending children as fit in the batch
+// next to the children that haven't stopped yet
+func (repo *jobRepository) TakePendingChildren(parentID creamqueue.JobID, batchSize int) []creamqueue.JobData {
+	// the write lock keeps every job lock free, so jobs can be changed directly
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	parent, ok := repo.jobs[parentID]
+	if !ok {
+		return nil
+	}
+
+	free := batchSize
+	for _, child := range repo.childrenOf(parent) {
+		if child.StoppedAt.IsZero() {
+			free--
+		}
+	}
+	if free <= 0 {
+		return nil
+	}
+	if free > len(parent.PendingChildren) {
+		free = len(parent.PendingChildren)
+	}
+
+	taken := parent.PendingChildren[:free]
+	parent.PendingChildren = parent.PendingChildren[free:]
+	if len(parent.PendingChildren) == 0 {
+		// let go of the backing array
+		parent.PendingChildren = nil
+	}
+	return taken
+}
+
+// DropPendingChildren forgets the children of the playlist job that weren't queued yet,
+// returning how many there were
+func (repo *jobRepository) DropPendingChildren(parentID creamqueue.JobID) int {
+	dropped := 0
+	repo.Update(parentID, func(job *jobInformation) {
+		dropped = len(job.PendingChildren)
+		job.PendingChildren = nil
+	})
+	return dropped
+}
+
+// UpdatePendingChildren changes every child of the playlist job that wasn't queued yet
+func (repo *jobRepository) UpdatePendingChildren(parentID creamqueue.JobID, updater func(data *creamqueue.JobData)) int {
+	updated := 0
+	repo.Update(parentID, func(job *jobInformation) {
+		for i := range job.PendingChildren {
+			updater(&job.PendingChildren[i])
+		}
+		updated = len(job.PendingChildren)
+	})
+	return updated
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+func TestExpandPlaylist(t *testing.T) {
+	useTestQueue(t)
+	config.playlistBatchSize = 2
+
+	completed := 0
+	jobRepo.OnGroupCompleted(func(id creamqueue.JobID, data creamqueue.JobData, counts groupCounts) {
+		completed++
+	})
+
+	queue.Push("playlist", creamqueue.JobData{URL: "https://example.com/playlist"})
+	queue.Pull(context.Background())
+
+	children := make([]creamqueue.JobData, 5)
+	for i := range children {
+		children[i] = creamqueue.JobData{URL: fmt.Sprintf("https://example.com/%v", i), ParentJobID: "playlist", ParentPlaylistID: "PL1"}
+	}
+	expandPlaylist("playlist", children)
+	stopTestJob(jobRepo, "playlist", "finished")
+
+	counts := func() groupCounts {
+		var counts groupCounts
+		jobRepo.View("playlist", func(job *jobInformation) {
+			counts.Total = len(job.Children)
+			counts.Pending = len(job.PendingChildren)
+		})
+		return counts
+	}
+
+	if got := counts(); got.Total != 2 || got.Pending != 3 {
+		t.Fatalf("expanded %v children with %v pending, want 2 and 3", got.Total, got.Pending)
+	}
+
+	// nothing is released while the batch is full
+	releaseChildren("playlist")
+	if got := counts(); got.Total != 2 {
+		t.Fatalf("released %v children into a full batch", got.Total-2)
+	}
+
+	var first creamqueue.JobID
+	jobRepo.View("playlist", func(job *jobInformation) {
+		first = job.Children[0]
+	})
+	cancelWaitingJob(first)
+	if got := counts(); got.Total != 3 || got.Pending != 2 {
+		t.Fatalf("%v children with %v pending after one stopped, want 3 and 2", got.Total, got.Pending)
+	}
+
+	if result := cancelGroup(groupMembers("", groupKindPlaylist, "PL1")); len(result.Changed) != 2 || result.Pending != 2 {
+		t.Errorf("cancelGroup() cancelled %v and dropped %v, want 2 and 2", result.Changed, result.Pending)
+	}
+
+	// cancelling the rest of the group completes it
+	if got := counts(); got.Total != 3 || got.Pending != 0 || completed != 1 {
+		t.Errorf("%v children with %v pending and %v completions, want 3, 0 and 1", got.Total, got.Pending, completed)
+	}
+}
@@ -0,0 +1,178 @@
+package ffmpegwrapper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Wrapper for the ffmpeg and ffprobe binaries
+type Wrapper struct {
+	BinPath      string
+	ProbeBinPath string
+}
+
+// RunWithProgress runs ffmpeg with the given arguments and provides progress updates.
+// Existing output files are overwritten.
+func (wrapper *Wrapper) RunWithProgress(ctx context.Context, callback func(*Progress), args ...string) error {
+	args = append([]string{"-y", "-nostdin", "-nostats", "-progress", "pipe:1"}, args...)
+	cmd := exec.CommandContext(ctx, wrapper.BinPath, args...)
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	read := make(chan bool)
+	go func() {
+		defer close(read)
+
+		parser := progressParser{}
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			progress := parser.parseLine(scanner.Text())
+			if progress != nil {
+				callback(progress)
+			}
+		}
+		// a line too long for the scanner stops it early, ffmpeg would block on the full pipe
+		io.Copy(ioutil.Discard, stdout)
+	}()
+
+	// Wait closes stdout, so everything is read first.
+	// This also keeps the callback from being called after returning.
+	<-read
+	err = cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// ExtractFrame writes the frame at the given offset of the input as an image
+func (wrapper *Wrapper) ExtractFrame(ctx context.Context, input string, at time.Duration, output string) error {
+	cmd := exec.CommandContext(
+		ctx,
+		wrapper.BinPath,
+		"-y", "-nostdin", "-v", "error",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", input,
+		"-frames:v", "1",
+		"-q:v", "2",
+		output,
+	)
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %v", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+// ConvertSubtitle converts a subtitle file to the format of the output's extension
+func (wrapper *Wrapper) ConvertSubtitle(ctx context.Context, input, output string) error {
+	cmd := exec.CommandContext(ctx, wrapper.BinPath, "-y", "-nostdin", "-v", "error", "-i", input, output)
+
+	stderr := bytes.Buffer{}
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %v", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1]
+}
+
+// ProbeOutput describes a media file
+type ProbeOutput struct {
+	// FormatName is a comma-separated list, like "mov,mp4,m4a,3gp,3g2,mj2"
+	FormatName string
+	// Duration is in seconds, 0 if unknown
+	Duration float64
+
+	VideoCodec string
+	AudioCodec string
+	Width      int
+	Height     int
+}
+
+// Probe the given file using ffprobe
+func (wrapper *Wrapper) Probe(ctx context.Context, path string) (*ProbeOutput, error) {
+	output, err := exec.CommandContext(ctx, wrapper.ProbeBinPath, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}{}
+	if err := json.Unmarshal(output, &decoded); err != nil {
+		return nil, err
+	}
+
+	probed := &ProbeOutput{
+		FormatName: decoded.Format.FormatName,
+	}
+	probed.Duration, _ = strconv.ParseFloat(decoded.Format.Duration, 64)
+
+	for _, stream := range decoded.Streams {
+		switch {
+		case stream.CodecType == "video" && probed.VideoCodec == "":
+			probed.VideoCodec = stream.CodecName
+			probed.Width = stream.Width
+			probed.Height = stream.Height
+		case stream.CodecType == "audio" && probed.AudioCodec == "":
+			probed.AudioCodec = stream.CodecName
+		}
+	}
+
+	return probed, nil
+}
+
+// Make a default instance of the ffmpeg wrapper
+func Make() *Wrapper {
+	binPath := os.Getenv("CREAMY_FFMPEG_BIN_PATH")
+	if binPath == "" {
+		binPath = "ffmpeg"
+	}
+	probeBinPath := os.Getenv("CREAMY_FFPROBE_BIN_PATH")
+	if probeBinPath == "" {
+		probeBinPath = "ffprobe"
+	}
+	return &Wrapper{
+		BinPath:      binPath,
+		ProbeBinPath: probeBinPath,
+	}
+}
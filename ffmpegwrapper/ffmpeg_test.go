@@ -0,0 +1,36 @@
+package ffmpegwrapper
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWrapper_RunWithProgress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a shell script standing in for ffmpeg")
+	}
+
+	// prints its progress and exits right away, like a short recode
+	binPath := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\nprintf 'out_time_us=1000000\\nprogress=continue\\nout_time_us=2000000\\nprogress=end\\n'\n"
+	if err := ioutil.WriteFile(binPath, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		updates := []*Progress{}
+		wrapper := Wrapper{BinPath: binPath}
+		if err := wrapper.RunWithProgress(context.Background(), func(progress *Progress) {
+			updates = append(updates, progress)
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(updates) != 2 || !updates[1].Done {
+			t.Fatalf("got %v updates, want 2 ending with the last one", len(updates))
+		}
+	}
+}
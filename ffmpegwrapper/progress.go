@@ -0,0 +1,64 @@
+package ffmpegwrapper
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is a snapshot of ffmpeg's -progress output
+type Progress struct {
+	// OutTime is how far into the output ffmpeg is
+	OutTime time.Duration
+	// Speed is relative to realtime, like "1.5x"
+	Speed string
+	// Done is set on the last update
+	Done bool
+}
+
+// Percent returns how far along the output is, given its total duration in seconds
+func (progress *Progress) Percent(duration float64) float64 {
+	if duration <= 0 {
+		return 0
+	}
+	percent := progress.OutTime.Seconds() / duration * 100
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// progressParser collects key=value lines until a block ends with a progress= line
+type progressParser struct {
+	current Progress
+}
+
+func (parser *progressParser) parseLine(line string) *Progress {
+	// out_time_us=1234567
+	// speed=1.5x
+	// progress=continue
+
+	separator := strings.Index(line, "=")
+	if separator == -1 {
+		return nil
+	}
+	key := strings.TrimSpace(line[:separator])
+	value := strings.TrimSpace(line[separator+1:])
+
+	switch key {
+	case "out_time_us", "out_time_ms":
+		// despite the name, out_time_ms is in microseconds too
+		microseconds, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && microseconds >= 0 {
+			parser.current.OutTime = time.Duration(microseconds) * time.Microsecond
+		}
+	case "speed":
+		parser.current.Speed = value
+	case "progress":
+		progress := parser.current
+		progress.Done = value == "end"
+		return &progress
+	}
+
+	return nil
+}
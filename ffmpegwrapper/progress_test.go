@@ -0,0 +1,63 @@
+package ffmpegwrapper
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_progressParser_parseLine(t *testing.T) {
+	lines := []string{
+		"frame=120",
+		"fps=0.00",
+		"out_time_us=4004000",
+		"out_time_ms=4004000",
+		"out_time=00:00:04.004000",
+		"speed=8.01x",
+		"progress=continue",
+		"out_time_us=N/A",
+		"speed=N/A",
+		"progress=continue",
+		"out_time_us=10010000",
+		"speed=7.9x",
+		"progress=end",
+	}
+
+	want := []*Progress{
+		{OutTime: 4004 * time.Millisecond, Speed: "8.01x"},
+		{OutTime: 4004 * time.Millisecond, Speed: "N/A"},
+		{OutTime: 10010 * time.Millisecond, Speed: "7.9x", Done: true},
+	}
+
+	parser := progressParser{}
+	got := []*Progress{}
+	for _, line := range lines {
+		if progress := parser.parseLine(line); progress != nil {
+			got = append(got, progress)
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseLine() = %+v, want %+v", got, want)
+	}
+}
+
+func TestProgress_Percent(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress Progress
+		duration float64
+		want     float64
+	}{
+		{"unknown duration", Progress{OutTime: time.Second}, 0, 0},
+		{"half", Progress{OutTime: 5 * time.Second}, 10, 50},
+		{"overshoot", Progress{OutTime: 11 * time.Second}, 10, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.progress.Percent(tt.duration); got != tt.want {
+				t.Errorf("Percent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
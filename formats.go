@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// defaultFormatProfileName is the built-in profile, used when nothing else
+// was picked unless the config file says otherwise
+const defaultFormatProfileName = "default"
+
+// A formatProfile is a named set of yt-dlp format options
+type formatProfile struct {
+	// Format is passed as -f, like "bv*[height<=720]+ba/b[height<=720]"
+	Format string `json:"format"`
+	// Sort is passed as -S, like "res:720,ext"
+	Sort string `json:"sort"`
+	// MergeOutputFormat is passed as --merge-output-format, like "mp4"
+	MergeOutputFormat string `json:"merge_output_format"`
+}
+
+var builtinFormatProfiles = map[string]formatProfile{
+	defaultFormatProfileName: {
+		Format: "best[ext=mp4]/best[ext=webm]/best/mp4/webm",
+	},
+}
+
+// args returns the yt-dlp arguments for this profile
+func (profile *formatProfile) args() []string {
+	args := []string{}
+	if profile.Format != "" {
+		args = append(args, "-f", profile.Format)
+	}
+	if profile.Sort != "" {
+		args = append(args, "-S", profile.Sort)
+	}
+	if profile.MergeOutputFormat != "" {
+		args = append(args, "--merge-output-format", profile.MergeOutputFormat)
+	}
+	return args
+}
+
+func validateFormatProfile(name string) error {
+	if _, ok := formatProfiles[name]; !ok {
+		return fmt.Errorf("unknown format profile %q", name)
+	}
+	return nil
+}
+
+// formatProfileNames returns the names of every profile, sorted
+func formatProfileNames() []string {
+	names := make([]string, 0, len(formatProfiles))
+	for name := range formatProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pickFormatProfile returns the profile asked for by the job, or by the tag rules,
+// or the default one
+func pickFormatProfile(jobProfile, ruleProfile string) (string, formatProfile) {
+	name := config.defaultFormatProfile
+	if jobProfile != "" {
+		name = jobProfile
+	} else if ruleProfile != "" {
+		name = ruleProfile
+	}
+	return name, formatProfiles[name]
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/gorilla/mux"
+)
+
+// groupCounts sums up the statuses of the children of a playlist job
+type groupCounts struct {
+	Total int `json:"total"`
+	// Pending children haven't been queued yet
+	Pending   int `json:"pending"`
+	Waiting   int `json:"waiting"`
+	Running   int `json:"running"`
+	Finished  int `json:"finished"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// countChildren counts the children of the playlist job, including the ones not queued yet
+func countChildren(job *jobInformation, children []*jobInformation) groupCounts {
+	counts := groupCounts{
+		Total:   len(children) + len(job.PendingChildren),
+		Pending: len(job.PendingChildren),
+	}
+	for _, child := range children {
+		switch child.Status {
+		case "waiting", "scheduled":
+			counts.Waiting++
+		case "started":
+			counts.Running++
+		case "finished":
+			counts.Finished++
+		case "failed":
+			counts.Failed++
+		case "cancelled":
+			counts.Cancelled++
+		}
+	}
+	return counts
+}
+
+// settled returns true once the job and everything it queued has stopped
+func (job *jobInformation) settled() bool {
+	if job.StoppedAt.IsZero() || len(job.PendingChildren) > 0 {
+		return false
+	}
+	return len(job.Children) == 0 || !job.GroupCompletedAt.IsZero()
+}
+
+// A GroupCompletedHandler is called once every child of a playlist job has stopped
+type GroupCompletedHandler func(id creamqueue.JobID, data creamqueue.JobData, counts groupCounts)
+
+func (repo *jobRepository) OnGroupCompleted(handler GroupCompletedHandler) {
+	repo.lock.Lock()
+	repo.groupCompletedHandlers = append(repo.groupCompletedHandlers, handler)
+	repo.lock.Unlock()
+}
+
+// AddChild links a job to the playlist job that queued it.
+// A retried child reopens the groups it completed.
+func (repo *jobRepository) AddChild(parentID, childID creamqueue.JobID) {
+	// the write lock keeps every job lock free, so jobs can be changed directly
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	parent, ok := repo.jobs[parentID]
+	if !ok {
+		return
+	}
+
+	known := false
+	for _, id := range parent.Children {
+		known = known || id == childID
+	}
+	if !known {
+		parent.Children = append(parent.Children, childID)
+	}
+
+	for ok && !parent.GroupCompletedAt.IsZero() {
+		parent.GroupCompletedAt = time.Time{}
+		parent, ok = repo.jobs[parent.ParentID]
+	}
+}
+
+// childrenOf returns the children of the job still in the repository,
+// repo.lock must be held
+func (repo *jobRepository) childrenOf(job *jobInformation) []*jobInformation {
+	children := []*jobInformation{}
+	for _, childID := range job.Children {
+		if child, ok := repo.jobs[childID]; ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Settle completes the groups that were waiting on the stopped job,
+// walking up its ancestry
+func (repo *jobRepository) Settle(id creamqueue.JobID) {
+	type completion struct {
+		id     creamqueue.JobID
+		data   creamqueue.JobData
+		counts groupCounts
+	}
+	completions := []completion{}
+
+	// the write lock keeps every job lock free, so jobs can be changed directly
+	repo.lock.Lock()
+walk:
+	for id != "" {
+		job, ok := repo.jobs[id]
+		if !ok || job.StoppedAt.IsZero() || !job.GroupCompletedAt.IsZero() || len(job.PendingChildren) > 0 {
+			break
+		}
+
+		if len(job.Children) > 0 {
+			children := repo.childrenOf(job)
+			for _, child := range children {
+				if !child.settled() {
+					break walk
+				}
+			}
+
+			job.GroupCompletedAt = time.Now()
+			completions = append(completions, completion{job.ID, job.Data, countChildren(job, children)})
+		}
+
+		id = job.ParentID
+	}
+	handlers := repo.groupCompletedHandlers
+	repo.lock.Unlock()
+
+	for _, completed := range completions {
+		for _, handler := range handlers {
+			handler(completed.id, completed.data, completed.counts)
+		}
+	}
+}
+
+// A jobNode is a job listed with the jobs it queued
+type jobNode struct {
+	Job      *jobInformation
+	Children []*jobNode
+	Counts   groupCounts
+}
+
+// buildJobTree nests the jobs under their parents, keeping the order of the jobs.
+// Jobs whose parent isn't listed are listed on their own.
+func buildJobTree(jobs []*jobInformation) []*jobNode {
+	nodes := make(map[creamqueue.JobID]*jobNode, len(jobs))
+	for _, job := range jobs {
+		nodes[job.ID] = &jobNode{Job: job, Children: []*jobNode{}}
+	}
+
+	roots := []*jobNode{}
+	for _, job := range jobs {
+		node := nodes[job.ID]
+		if parent, ok := nodes[job.ParentID]; ok && job.ParentID != "" {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	for _, node := range nodes {
+		children := make([]*jobInformation, len(node.Children))
+		for i, child := range node.Children {
+			children[i] = child.Job
+		}
+		node.Counts = countChildren(node.Job, children)
+
+		// children are listed in the order they were queued, like their playlist
+		sort.SliceStable(node.Children, func(i, j int) bool {
+			return node.Children[i].Job.CreatedAt.Before(node.Children[j].Job.CreatedAt)
+		})
+	}
+
+	return roots
+}
+
+const (
+	groupKindPlaylist = "playlist"
+	groupKindBatch    = "batch"
+)
+
+// groupRef names a group in templates
+type groupRef struct {
+	Kind string
+	Key  string
+}
+
+func groupOf(kind, key string) groupRef {
+	return groupRef{kind, key}
+}
+
+// PlaylistID returns the ID of the playlist the children of the job were found in
+func (node *jobNode) PlaylistID() string {
+	if len(node.Children) == 0 {
+		return ""
+	}
+	return node.Children[0].Job.Data.ParentPlaylistID
+}
+
+// inGroup returns true if the job belongs to the group,
+// either the children of a playlist or the jobs of a batch
+func inGroup(kind, key string, data *creamqueue.JobData) bool {
+	switch kind {
+	case groupKindPlaylist:
+		return data.ParentPlaylistID == key
+	case groupKindBatch:
+		return data.BatchID == key
+	}
+	return false
+}
+
+func validateGroupKind(kind string) error {
+	switch kind {
+	case groupKindPlaylist, groupKindBatch:
+		return nil
+	}
+	return fmt.Errorf("unknown group %q, expected %q or %q", kind, groupKindPlaylist, groupKindBatch)
+}
+
+// groupMember is a copy of a job of a group, taken so the repository isn't locked while changing it
+type groupMember struct {
+	ID       creamqueue.JobID
+	ParentID creamqueue.JobID
+	Status   string
+	Data     creamqueue.JobData
+}
+
+// groupMembers returns the jobs of the group the user is allowed to change
+func groupMembers(user, kind, key string) []groupMember {
+	jobs, unlock := jobRepo.RLockMatching(func(job *jobInformation) bool {
+		return inGroup(kind, key, &job.Data) && canSeeJob(user, false, job)
+	})
+	defer unlock()
+
+	members := make([]groupMember, len(jobs))
+	for i, job := range jobs {
+		members[i] = groupMember{job.ID, job.ParentID, job.Status, job.Data}
+	}
+	return members
+}
+
+// groupActionResult lists the jobs of a group that were changed, out of how many it has
+type groupActionResult struct {
+	Matched int                `json:"matched"`
+	Changed []creamqueue.JobID `json:"changed"`
+	// Pending is how many children that weren't queued yet were changed too
+	Pending int `json:"pending"`
+}
+
+// groupParents returns the playlist jobs that queued the members
+func groupParents(members []groupMember) []creamqueue.JobID {
+	parents := []creamqueue.JobID{}
+	seen := map[creamqueue.JobID]bool{}
+	for _, member := range members {
+		if member.ParentID != "" && !seen[member.ParentID] {
+			seen[member.ParentID] = true
+			parents = append(parents, member.ParentID)
+		}
+	}
+	return parents
+}
+
+// cancelGroup cancels every waiting job of the group, and the children not queued yet
+func cancelGroup(members []groupMember) groupActionResult {
+	result := groupActionResult{Matched: len(members), Changed: []creamqueue.JobID{}}
+
+	// dropped first, so cancelled jobs don't make room for them
+	parents := groupParents(members)
+	for _, parentID := range parents {
+		result.Pending += jobRepo.DropPendingChildren(parentID)
+	}
+
+	for _, member := range members {
+		if cancelWaitingJob(member.ID) {
+			result.Changed = append(result.Changed, member.ID)
+		}
+	}
+
+	for _, parentID := range parents {
+		// the group might be done now that nothing else will be queued
+		jobRepo.Settle(parentID)
+	}
+	return result
+}
+
+// retryGroup queues every failed job of the group again
+func retryGroup(members []groupMember) groupActionResult {
+	result := groupActionResult{Matched: len(members), Changed: []creamqueue.JobID{}}
+	for _, member := range members {
+		if member.Status == "failed" && retryJob(member.ID) {
+			result.Changed = append(result.Changed, member.ID)
+		}
+	}
+	return result
+}
+
+// retagGroup replaces the tags of every waiting job of the group
+func retagGroup(members []groupMember, tags []string) groupActionResult {
+	tags = tagNormalizer.Tags(tags)
+
+	result := groupActionResult{Matched: len(members), Changed: []creamqueue.JobID{}}
+	for _, member := range members {
+		if updateWaitingJob(member.ID, func(data *creamqueue.JobData) {
+			data.Tags = append([]string{}, tags...)
+		}) {
+			result.Changed = append(result.Changed, member.ID)
+		}
+	}
+	for _, parentID := range groupParents(members) {
+		result.Pending += jobRepo.UpdatePendingChildren(parentID, func(data *creamqueue.JobData) {
+			data.Tags = append([]string{}, tags...)
+		})
+	}
+	return result
+}
+
+// deleteGroup removes every job of the group that is done from the history
+func deleteGroup(members []groupMember) groupActionResult {
+	ids := make([]creamqueue.JobID, len(members))
+	for i, member := range members {
+		ids[i] = member.ID
+	}
+
+	removed := jobRepo.RemoveSettled(ids)
+	for _, member := range members {
+		for _, id := range removed {
+			if member.ID == id {
+				removeStagedUpload(member.Data)
+			}
+		}
+	}
+	return groupActionResult{Matched: len(members), Changed: removed}
+}
+
+// RemoveSettled removes the jobs that are done, and the playlist jobs left without children.
+// It returns the removed jobs.
+func (repo *jobRepository) RemoveSettled(ids []creamqueue.JobID) []creamqueue.JobID {
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	removed := []creamqueue.JobID{}
+	for len(ids) > 0 {
+		id := ids[0]
+		ids = ids[1:]
+
+		job, ok := repo.jobs[id]
+		if !ok || !job.settled() || len(repo.childrenOf(job)) > 0 {
+			continue
+		}
+
+		delete(repo.jobs, id)
+		removed = append(removed, id)
+
+		if job.ParentID != "" {
+			ids = append(ids, job.ParentID)
+		}
+	}
+	return removed
+}
+
+// apiRetagGroupRequest is the JSON body accepted when changing the tags of a group
+type apiRetagGroupRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// groupAction runs the action named in the route against the group named in the route
+func groupAction(r *http.Request, tags []string) (groupActionResult, int, error) {
+	vars := mux.Vars(r)
+	kind, key := vars["kind"], vars["key"]
+	if err := validateGroupKind(kind); err != nil {
+		return groupActionResult{}, 404, err
+	}
+
+	members := groupMembers(requestUser(r), kind, key)
+	if len(members) == 0 {
+		return groupActionResult{}, 404, errors.New("group not found")
+	}
+
+	switch vars["action"] {
+	case "cancel":
+		return cancelGroup(members), 200, nil
+	case "retry":
+		return retryGroup(members), 200, nil
+	case "tags":
+		return retagGroup(members, tags), 200, nil
+	case "delete":
+		return deleteGroup(members), 200, nil
+	}
+	return groupActionResult{}, 404, errors.New("unknown action")
+}
+
+func handlerGroupAction(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte("bad data"))
+		return
+	}
+
+	if _, status, err := groupAction(r, splitTags(r.FormValue("tags"))); err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	http.Redirect(w, r, "/", 302)
+}
+
+func handlerAPIGroupAction(w http.ResponseWriter, r *http.Request) {
+	request := apiRetagGroupRequest{}
+	if mux.Vars(r)["action"] == "tags" {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeJSONError(w, 400, "bad data")
+			return
+		}
+		if request.Tags == nil {
+			writeJSONError(w, 422, "missing \"tags\" value")
+			return
+		}
+	}
+
+	result, status, err := groupAction(r, request.Tags)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, status, result)
+}
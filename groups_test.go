@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/autoid"
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/tagrules"
+)
+
+// useTestQueue gives the test a fresh queue and job repository without workers,
+// putting the previous ones back once the test is done.
+// Queue handlers run in the background, so tests stop jobs through the repository instead.
+func useTestQueue(t *testing.T) {
+	t.Helper()
+
+	previousQueue, previousRepo, previousIDs, previousNormalizer, previousConfig := queue, jobRepo, idGenerator, tagNormalizer, config
+	previousCancelledHandlers := cancelledHandlers
+	t.Cleanup(func() {
+		queue, jobRepo, idGenerator, tagNormalizer, config = previousQueue, previousRepo, previousIDs, previousNormalizer, previousConfig
+		cancelledHandlers = previousCancelledHandlers
+	})
+
+	queue = creamqueue.MakeHeapQueue(nil)
+	jobRepo = makeJobRepository()
+	idGenerator = autoid.Make()
+	tagNormalizer = tagrules.MakeNormalizer(tagrules.Normalization{})
+	config.parallelWorkers = 0
+	cancelledHandlers = nil
+	bootQueue(context.Background())
+}
+
+func storeTestJob(repo *jobRepository, id, parentID creamqueue.JobID, createdAt time.Time) {
+	repo.Store(id, func(job *jobInformation) {
+		job.CreatedAt = createdAt
+		job.Status = "waiting"
+		job.ParentID = parentID
+	})
+	if parentID != "" {
+		repo.AddChild(parentID, id)
+	}
+}
+
+func stopTestJob(repo *jobRepository, id creamqueue.JobID, status string) {
+	repo.Update(id, func(job *jobInformation) {
+		job.StoppedAt = time.Now()
+		job.Status = status
+	})
+	repo.Settle(id)
+}
+
+func TestJobRepositorySettle(t *testing.T) {
+	repo := makeJobRepository()
+
+	completed := []creamqueue.JobID{}
+	counts := map[creamqueue.JobID]groupCounts{}
+	repo.OnGroupCompleted(func(id creamqueue.JobID, data creamqueue.JobData, groupCounts groupCounts) {
+		completed = append(completed, id)
+		counts[id] = groupCounts
+	})
+
+	now := time.Now()
+	// channel -> tab -> two videos, and a video straight in the channel
+	storeTestJob(repo, "channel", "", now)
+	storeTestJob(repo, "tab", "channel", now.Add(time.Second))
+	storeTestJob(repo, "video-1", "channel", now.Add(2*time.Second))
+	storeTestJob(repo, "video-2", "tab", now.Add(3*time.Second))
+	storeTestJob(repo, "video-3", "tab", now.Add(4*time.Second))
+
+	// children can stop before their playlist job does
+	stopTestJob(repo, "video-1", "finished")
+	stopTestJob(repo, "channel", "finished")
+	stopTestJob(repo, "tab", "finished")
+	stopTestJob(repo, "video-2", "failed")
+	if len(completed) != 0 {
+		t.Fatalf("groups completed early: %v", completed)
+	}
+
+	stopTestJob(repo, "video-3", "finished")
+	if want := []creamqueue.JobID{"tab", "channel"}; !reflect.DeepEqual(completed, want) {
+		t.Fatalf("completed = %v, want %v", completed, want)
+	}
+	if want := (groupCounts{Total: 2, Finished: 1, Failed: 1}); counts["tab"] != want {
+		t.Errorf("tab counts = %+v, want %+v", counts["tab"], want)
+	}
+	if want := (groupCounts{Total: 2, Finished: 2}); counts["channel"] != want {
+		t.Errorf("channel counts = %+v, want %+v", counts["channel"], want)
+	}
+
+	// groups only complete once
+	repo.Settle("video-3")
+	if len(completed) != 2 {
+		t.Errorf("completed again: %v", completed)
+	}
+}
+
+func TestJobRepositoryPurgeStoppedKeepsGroups(t *testing.T) {
+	repo := makeJobRepository()
+
+	old := time.Now().Add(-2 * time.Hour)
+	storeTestJob(repo, "playlist", "", old)
+	storeTestJob(repo, "video-1", "playlist", old)
+	storeTestJob(repo, "video-2", "playlist", old)
+	stopTestJob(repo, "playlist", "finished")
+	stopTestJob(repo, "video-1", "finished")
+	repo.Update("playlist", func(job *jobInformation) {
+		job.StoppedAt = old
+	})
+	repo.Update("video-1", func(job *jobInformation) {
+		job.StoppedAt = old
+	})
+
+	if purged := repo.PurgeStopped(time.Hour); purged != 0 {
+		t.Fatalf("purged %v jobs of an unfinished group", purged)
+	}
+
+	stopTestJob(repo, "video-2", "finished")
+	// the group just completed, so the playlist job stays a while longer
+	if purged := repo.PurgeStopped(time.Hour); purged != 1 {
+		t.Errorf("purged %v jobs, want only the old child", purged)
+	}
+}
+
+func Test_buildJobTree(t *testing.T) {
+	now := time.Now()
+	playlist := &jobInformation{ID: "playlist", CreatedAt: now}
+	first := &jobInformation{ID: "first", ParentID: "playlist", Status: "finished", CreatedAt: now.Add(time.Second)}
+	second := &jobInformation{ID: "second", ParentID: "playlist", Status: "started", CreatedAt: now.Add(2 * time.Second)}
+	orphan := &jobInformation{ID: "orphan", ParentID: "purged", Status: "waiting", CreatedAt: now.Add(3 * time.Second)}
+
+	// newest first, like RLockMatching
+	roots := buildJobTree([]*jobInformation{orphan, second, first, playlist})
+
+	if len(roots) != 2 || roots[0].Job != orphan || roots[1].Job != playlist {
+		t.Fatalf("unexpected roots %+v", roots)
+	}
+
+	children := roots[1].Children
+	if len(children) != 2 || children[0].Job != first || children[1].Job != second {
+		t.Errorf("children aren't listed in playlist order: %+v", children)
+	}
+	if want := (groupCounts{Total: 2, Running: 1, Finished: 1}); roots[1].Counts != want {
+		t.Errorf("counts = %+v, want %+v", roots[1].Counts, want)
+	}
+}
+
+func TestGroupActions(t *testing.T) {
+	useTestQueue(t)
+
+	completed := []creamqueue.JobID{}
+	jobRepo.OnGroupCompleted(func(id creamqueue.JobID, data creamqueue.JobData, counts groupCounts) {
+		completed = append(completed, id)
+	})
+
+	queue.Push("playlist", creamqueue.JobData{URL: "https://example.com/playlist"})
+	queue.Pull(context.Background())
+	for _, id := range []creamqueue.JobID{"video-1", "video-2", "video-3"} {
+		queue.Push(id, creamqueue.JobData{URL: "https://example.com/" + string(id), ParentJobID: "playlist", ParentPlaylistID: "PL1"})
+	}
+	queue.Push("unrelated", creamqueue.JobData{URL: "https://example.com/unrelated"})
+
+	// queue handlers run in the background, so the jobs are stopped here instead
+	stopTestJob(jobRepo, "playlist", "finished")
+	queue.RemoveWaiting("video-1")
+	stopTestJob(jobRepo, "video-1", "failed")
+
+	status := func(id creamqueue.JobID) string {
+		found := ""
+		jobRepo.View(id, func(job *jobInformation) {
+			found = job.Status
+		})
+		return found
+	}
+
+	members := groupMembers("", groupKindPlaylist, "PL1")
+	if len(members) != 3 {
+		t.Fatalf("found %v members, want 3", len(members))
+	}
+
+	result := retagGroup(members, []string{"Food"})
+	if want := []creamqueue.JobID{"video-2", "video-3"}; !reflect.DeepEqual(sortedIDs(result.Changed), want) {
+		t.Errorf("retagGroup() changed %v, want %v", result.Changed, want)
+	}
+	jobRepo.View("video-2", func(job *jobInformation) {
+		if !reflect.DeepEqual(job.Data.Tags, []string{"food"}) {
+			t.Errorf("video-2 tags = %v, want [food]", job.Data.Tags)
+		}
+	})
+
+	result = cancelGroup(members)
+	if want := []creamqueue.JobID{"video-2", "video-3"}; !reflect.DeepEqual(sortedIDs(result.Changed), want) {
+		t.Errorf("cancelGroup() changed %v, want %v", result.Changed, want)
+	}
+	if status("video-2") != "cancelled" || status("unrelated") != "waiting" {
+		t.Errorf("unexpected statuses %v and %v", status("video-2"), status("unrelated"))
+	}
+	if want := []creamqueue.JobID{"playlist"}; !reflect.DeepEqual(completed, want) {
+		t.Fatalf("completed = %v, want %v", completed, want)
+	}
+
+	result = retryGroup(groupMembers("", groupKindPlaylist, "PL1"))
+	if want := []creamqueue.JobID{"video-1"}; !reflect.DeepEqual(result.Changed, want) {
+		t.Errorf("retryGroup() changed %v, want %v", result.Changed, want)
+	}
+	if status("video-1") != "waiting" {
+		t.Errorf("retried video-1 is %v, want waiting", status("video-1"))
+	}
+	jobRepo.View("playlist", func(job *jobInformation) {
+		if !job.GroupCompletedAt.IsZero() || len(job.Children) != 3 {
+			t.Errorf("retry didn't reopen the group: %v, %v", job.GroupCompletedAt, job.Children)
+		}
+	})
+
+	// the retried job is still waiting, so only the cancelled ones go
+	result = deleteGroup(groupMembers("", groupKindPlaylist, "PL1"))
+	if want := []creamqueue.JobID{"video-2", "video-3"}; !reflect.DeepEqual(sortedIDs(result.Changed), want) {
+		t.Errorf("deleteGroup() removed %v, want %v", result.Changed, want)
+	}
+
+	cancelGroup(groupMembers("", groupKindPlaylist, "PL1"))
+	result = deleteGroup(groupMembers("", groupKindPlaylist, "PL1"))
+	if want := []creamqueue.JobID{"video-1", "playlist"}; !reflect.DeepEqual(result.Changed, want) {
+		t.Errorf("deleteGroup() removed %v, want %v", result.Changed, want)
+	}
+}
+
+func sortedIDs(ids []creamqueue.JobID) []creamqueue.JobID {
+	sorted := append([]creamqueue.JobID{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// failTestJob pulls the job until the queue gives up on it
+func failTestJob(t *testing.T, id creamqueue.JobID) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		failed := false
+		jobRepo.View(id, func(job *jobInformation) {
+			failed = job.Status == "failed"
+		})
+		if failed {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if job := queue.Pull(ctx); job != nil {
+			job.Failed(&creamqueue.JobFailure{Error: errors.New("broken")})
+		}
+		cancel()
+	}
+	t.Fatalf("job %v didn't fail", id)
+}
+
+func TestRetryGroupUploads(t *testing.T) {
+	useTestQueue(t)
+	config.stagingDir = t.TempDir()
+
+	path, err := stageUpload(config.stagingDir, "clip.mp4", strings.NewReader("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Push("upload", creamqueue.JobData{URL: "upload:clip.mp4", LocalPath: path, LocalSource: localSourceUpload, BatchID: "B1"})
+	failTestJob(t, "upload")
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("failed upload was removed: %v", err)
+	}
+	members := groupMembers("", groupKindBatch, "B1")
+	if result := retryGroup(members); len(result.Changed) != 1 {
+		t.Fatalf("retryGroup() changed %v, want the upload", result.Changed)
+	}
+	// a second retry of the same members, like a double click, finds the upload queued already
+	if result := retryGroup(members); len(result.Changed) != 0 {
+		t.Fatalf("retryGroup() changed %v again, want nothing", result.Changed)
+	}
+
+	failTestJob(t, "upload")
+	if result := deleteGroup(groupMembers("", groupKindBatch, "B1")); len(result.Changed) != 1 {
+		t.Fatalf("deleteGroup() removed %v, want the upload", result.Changed)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("deleted upload is still staged: %v", err)
+	}
+
+	// uploads whose file is gone can't be retried
+	queue.Push("gone", creamqueue.JobData{URL: "upload:gone.mp4", LocalPath: path, LocalSource: localSourceUpload, BatchID: "B2"})
+	failTestJob(t, "gone")
+	if result := retryGroup(groupMembers("", groupKindBatch, "B2")); len(result.Changed) != 0 {
+		t.Errorf("retryGroup() changed %v, want nothing", result.Changed)
+	}
+}
@@ -2,16 +2,250 @@ package main
 
 import (
 	"context"
+	"errors"
 	"html/template"
 	"log"
 	"net/http"
-	"sort"
 	"strings"
 	"time"
 
 	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/gorilla/mux"
 )
 
+const rawTemplateJobOptions = `
+{{ define "jobOptions" }}
+	<input class="input input--tags" type="text" name="tags" placeholder="food,food:korean">
+	<select class="input input--priority" name="priority">
+		<option value="low">Low</option>
+		<option value="normal" selected>Normal</option>
+		<option value="high">High</option>
+	</select>
+	<label>
+		Not before
+		<input class="input input--not-before" type="datetime-local" name="not_before">
+	</label>
+	{{ if .DownloadWindows }}
+		<label>
+			<input type="checkbox" name="in_download_window" value="1">
+			Wait for {{ range $i, $window := .DownloadWindows }}{{ if $i }}, {{ end }}{{ $window }}{{ end }}
+		</label>
+	{{ end }}
+	<details class="options">
+		<summary>More</summary>
+		<label>
+			Format
+			<select class="input input--format" name="format_profile">
+				<option value="">Automatic ({{ .DefaultFormatProfile }})</option>
+				{{ range .FormatProfiles }}
+					<option value="{{ . }}">{{ . }}</option>
+				{{ end }}
+			</select>
+		</label>
+		<label>
+			Post-processing
+			<select class="input input--recode" name="recode_profile">
+				<option value="">Automatic ({{ .DefaultRecodeProfile }})</option>
+				{{ range .RecodeProfiles }}
+					<option value="{{ . }}">{{ . }}</option>
+				{{ end }}
+			</select>
+		</label>
+		<label>
+			Subtitles
+			<input class="input input--subtitles" type="text" name="subtitle_languages" placeholder="en,de">
+		</label>
+		<label>
+			<input type="checkbox" name="auto_subtitles" value="1">
+			Include auto-generated subtitles
+		</label>
+		<label>
+			<input type="checkbox" name="split_chapters" value="1">
+			Upload every chapter as its own video
+		</label>
+		<fieldset class="playlist">
+			<legend>Playlists</legend>
+			<label>
+				Items
+				<input class="input input--playlist-items" type="text" name="playlist_items" placeholder="1-20,25,30-">
+			</label>
+			<label>
+				Last
+				<input class="input input--number" type="number" name="playlist_last" min="0">
+			</label>
+			<label>
+				At most
+				<input class="input input--number" type="number" name="playlist_max" min="0">
+			</label>
+			<label>
+				<input type="checkbox" name="playlist_reverse" value="1">
+				Reverse order
+			</label>
+			<label>
+				Uploaded after
+				<input class="input" type="date" name="playlist_date_after">
+			</label>
+			<label>
+				Uploaded before
+				<input class="input" type="date" name="playlist_date_before">
+			</label>
+			<label>
+				Title matches
+				<input class="input input--template" type="text" name="playlist_title_include" placeholder="(?i)trailer">
+			</label>
+			<label>
+				Title doesn't match
+				<input class="input input--template" type="text" name="playlist_title_exclude" placeholder="(?i)live">
+			</label>
+			<label>
+				Longer than (seconds)
+				<input class="input input--number" type="number" name="playlist_min_duration" min="0">
+			</label>
+			<label>
+				Shorter than (seconds)
+				<input class="input input--number" type="number" name="playlist_max_duration" min="0">
+			</label>
+		</fieldset>
+		<label>
+			Title template
+			<input class="input input--template" type="text" name="title_template" placeholder="{{ "{{ .Entry.Uploader }}: {{ .Entry.Title }}" }}">
+		</label>
+		<label>
+			Description template
+			<textarea class="input input--template" name="description_template" rows="3" placeholder="{{ "Original URL: {{ .URL }}" }}"></textarea>
+		</label>
+	</details>
+{{ end }}
+`
+
+const rawTemplateGroupActions = `
+{{ define "groupActions" }}
+	<div class="group-actions">
+		<form method="POST" action="/groups/{{ .Kind }}/{{ .Key }}/cancel">
+			<button type="submit">Cancel waiting</button>
+		</form>
+		<form method="POST" action="/groups/{{ .Kind }}/{{ .Key }}/retry">
+			<button type="submit">Retry failed</button>
+		</form>
+		<form method="POST" action="/groups/{{ .Kind }}/{{ .Key }}/tags">
+			<input class="input input--tags" type="text" name="tags" placeholder="food,food:korean">
+			<button type="submit">Retag waiting</button>
+		</form>
+		<form method="POST" action="/groups/{{ .Kind }}/{{ .Key }}/delete">
+			<button type="submit">Delete from history</button>
+		</form>
+	</div>
+{{ end }}
+`
+
+const rawTemplateJobRow = `
+{{ define "jobRow" }}
+	{{ $element := .Job }}
+	<tr>
+		<td>
+			<strong>Input:</strong>
+			<a href="{{ $element.Data.URL }}">
+				{{ $element.Data.URL }}
+			</a>
+
+			{{ if $element.Data.SubmittedBy }}
+				<span class="submitter">(by {{ $element.Data.SubmittedBy }})</span>
+			{{ end }}
+			{{ if $element.Data.PlaylistIndex }}
+				<span class="submitter">(#{{ $element.Data.PlaylistIndex }}{{ with $element.Data.PlaylistTitle }} of {{ . }}{{ end }})</span>
+			{{ end }}
+			{{ if $element.Data.BatchID }}
+				<span class="submitter">(batch {{ $element.Data.BatchID }})</span>
+			{{ end }}
+
+			{{ if $element.Data.Tags }}
+				<div class="tags">
+					{{ range $tag := $element.Data.Tags }}
+						<span class="tag">{{ $tag }}</span>
+					{{ end }}
+				</div>
+			{{ end }}
+
+			{{ if (eq $element.Status "scheduled") }}
+				<br>
+				Scheduled until {{ humanTime $element.ScheduledUntil }}
+			{{ end }}
+
+			{{ if (or (eq $element.Status "waiting") (eq $element.Status "scheduled")) }}
+				<form class="priority" method="POST" action="/jobs/{{ $element.ID }}/priority">
+					<label>Priority</label>
+					<select class="input input--priority" name="priority">
+						<option value="low" {{ if (eq $element.Data.Priority.String "low") }}selected{{ end }}>Low</option>
+						<option value="normal" {{ if (eq $element.Data.Priority.String "normal") }}selected{{ end }}>Normal</option>
+						<option value="high" {{ if (eq $element.Data.Priority.String "high") }}selected{{ end }}>High</option>
+					</select>
+					<button type="submit">Change</button>
+				</form>
+			{{ end }}
+
+			{{ if (eq $element.Status "started") }}
+				<br>
+				{{ $element.Progress }}
+			{{ end }}
+			{{ if (eq $element.Status "finished") }}
+				<br>
+				{{ if (eq $element.Result.CreamyURL "" ) }}
+					{{ $element.Result.Title }}
+				{{ else }}
+					<strong>Video:</strong>
+					<a href="{{ $element.Result.CreamyURL }}">
+						{{ $element.Result.Title }}
+					</a>
+				{{ end }}
+			{{ end }}
+			{{ if (eq $element.Status "failed") }}
+				<br>
+				<strong>Failure Reasons:</strong>
+				<ul>
+					{{ range $failure := $element.Failures }}
+						<li>{{ $failure.Error }}</li>
+					{{ end }}
+				</ul>
+			{{ end }}
+
+			{{ if .Children }}
+				<div class="group">
+					<strong>Children:</strong>
+					{{ .Counts.Finished }}/{{ .Counts.Total }} finished{{ if .Counts.Failed }}, {{ .Counts.Failed }} failed{{ end }}{{ if .Counts.Running }}, {{ .Counts.Running }} running{{ end }}{{ if .Counts.Cancelled }}, {{ .Counts.Cancelled }} cancelled{{ end }}{{ if .Counts.Pending }}, {{ .Counts.Pending }} not queued yet{{ end }}
+					{{ if not $element.GroupCompletedAt.IsZero }}
+						(completed {{ humanTime $element.GroupCompletedAt }})
+					{{ end }}
+				</div>
+				{{ with .PlaylistID }}
+					{{ template "groupActions" (groupOf "playlist" .) }}
+				{{ end }}
+			{{ end }}
+		</td>
+		<td>{{ humanTime $element.CreatedAt }}</td>
+		<td>{{ runtime $element }}</td>
+		<td class="status status--{{ $element.Status }}">
+			{{ $element.Status }}
+		</td>
+	</tr>
+	{{ if .Children }}
+		<tr class="children">
+			<td colspan="4">
+				<details data-group="{{ $element.ID }}">
+					<summary>{{ len .Children }} child jobs</summary>
+					<table>
+						<tbody>
+							{{ range .Children }}
+								{{ template "jobRow" . }}
+							{{ end }}
+						</tbody>
+					</table>
+				</details>
+			</td>
+		</tr>
+	{{ end }}
+{{ end }}
+`
+
 const rawTemplateViewJobs = `
 <!DOCTYPE html>
 <html lang="en">
@@ -43,10 +277,16 @@ const rawTemplateViewJobs = `
 			color: white;
 		}
 		.input+.input { margin-left: 0; }
-		.input--url {
+		.input--url, .input--urls {
 			width: 100%;
 			flex: 1;
 		}
+		.bulk { margin-top: 1em; }
+		.options label { display: block; margin: 0.5em 0; }
+		.input--template { width: 30em; }
+		.input--number { width: 6em; }
+		.playlist { border: 1px solid rgba(34, 36, 38, 0.15); margin: 0.5em 0; }
+		.bulk form { align-items: flex-start; margin-top: 1em; }
 
 		.tags { margin-top: 1em; }
 		.tag {
@@ -71,19 +311,60 @@ const rawTemplateViewJobs = `
 			border-collapse: collapse;
 		}
 
+		form.priority { margin-top: 1em; }
+		.filters { margin: 1em 0; }
+		.submitter { opacity: 0.7; }
+
 		.status--finished { color: lawngreen; }
 		.status--failed { color: crimson; }
 		.status--started { color: cornflowerblue; }
+		.status--scheduled { color: goldenrod; }
+		.status--cancelled { color: gray; }
+
+		.group { margin-top: 1em; }
+		.group-actions { display: flex; flex-wrap: wrap; margin-top: 0.5em; }
+		.group-actions form { margin-right: 1em; }
+		.children > td { border-top: none; padding-top: 0; }
+		.children table { margin-left: 1em; width: calc(100% - 1em); }
 		</style>
 	</head>
 	<body>
 		<form method="POST">
 			<label for="url">URL</label>
 			<input class="input input--url" type="text" name="url" placeholder="https://videos.example.com/video.mp4">
-			<input class="input input--tags" type="text" name="tags" placeholder="food,food:korean">
+			{{ template "jobOptions" . }}
 
 			<button type="submit">Queue</button>
+			<button type="submit" formaction="/preview">Preview</button>
 		</form>
+		<details class="bulk">
+			<summary>Bulk import</summary>
+			<form method="POST" action="/bulk" enctype="multipart/form-data">
+				<textarea class="input input--urls" name="urls" rows="5" placeholder="https://videos.example.com/video.mp4&#10;https://videos.example.com/other.mp4 food,food:korean"></textarea>
+				<input class="input" type="file" name="file" accept=".txt,.csv,.jsonl,.ndjson,text/plain,text/csv">
+				{{ template "jobOptions" . }}
+
+				<button type="submit">Queue All</button>
+			</form>
+		</details>
+		<details class="bulk">
+			<summary>Upload a file</summary>
+			<form method="POST" action="/upload" enctype="multipart/form-data">
+				<input class="input input--file" type="file" name="file" accept="video/*,audio/*" required>
+				{{ template "jobOptions" . }}
+
+				<button type="submit">Upload</button>
+			</form>
+		</details>
+		{{ if .IsAdmin }}
+			<div class="filters">
+				{{ if .OnlyMine }}
+					<a href="/">All jobs</a> | <strong>My jobs</strong>
+				{{ else }}
+					<strong>All jobs</strong> | <a href="/?mine=1">My jobs</a>
+				{{ end }}
+			</div>
+		{{ end }}
 		<table>
 			<thead>
 				<tr>
@@ -94,53 +375,8 @@ const rawTemplateViewJobs = `
 				</tr>
 			</thead>
 			<tbody>
-				{{ range $element := .Jobs }}
-					<tr>
-						<td>
-							<strong>Input:</strong>
-							<a href="{{ $element.Data.URL }}">
-								{{ $element.Data.URL }}
-							</a>
-
-							{{ if $element.Data.Tags }}
-								<div class="tags">
-									{{ range $tag := $element.Data.Tags }}
-										<span class="tag">{{ $tag }}</span>
-									{{ end }}
-								</div>
-							{{ end }}
-
-							{{ if (eq $element.Status "started") }}
-								<br>
-								{{ $element.Progress }}
-							{{ end }}
-							{{ if (eq $element.Status "finished") }}
-								<br>
-								{{ if (eq $element.Result.CreamyURL "" ) }}
-									{{ $element.Result.Title }}
-								{{ else }}
-									<strong>Video:</strong>
-									<a href="{{ $element.Result.CreamyURL }}">
-										{{ $element.Result.Title }}
-									</a>
-								{{ end }}
-							{{ end }}
-							{{ if (eq $element.Status "failed") }}
-								<br>
-								<strong>Failure Reasons:</strong>
-								<ul>
-									{{ range $failure := $element.Failures }}
-										<li>{{ $failure.Error }}</li>
-									{{ end }}
-								</ul>
-							{{ end }}
-						</td>
-						<td>{{ humanTime $element.CreatedAt }}</td>
-						<td>{{ runtime $element }}</td>
-						<td class="status status--{{ $element.Status }}">
-							{{ $element.Status }}
-						</td>
-					</tr>
+				{{ range .Jobs }}
+					{{ template "jobRow" . }}
 				{{ end }}
 			</tbody>
 		</table>
@@ -155,7 +391,7 @@ const rawTemplateViewJobs = `
 						return;
 					}
 
-					fetch('/?autofetch').then(function (resp) {
+					fetch(window.location.pathname + (window.location.search || '?') + '&autofetch').then(function (resp) {
 						return resp.text();
 					}).then(function (text) {
 						var el = document.createElement('html');
@@ -163,7 +399,17 @@ const rawTemplateViewJobs = `
 
 						var remoteTable = el.querySelector('table');
 						if (localTable && remoteTable) {
+							// keep expanded groups expanded
+							var open = Array.prototype.map.call(localTable.querySelectorAll('details[open]'), function (details) {
+								return details.getAttribute('data-group');
+							});
 							localTable.innerHTML = remoteTable.innerHTML;
+							open.forEach(function (group) {
+								var details = localTable.querySelector('details[data-group="' + group + '"]');
+								if (details) {
+									details.open = true;
+								}
+							});
 						}
 
 						fetching = false;
@@ -185,6 +431,7 @@ var templateViewJobs = template.Must(template.New("viewJobs").Funcs(template.Fun
 		}
 		return timestamp.Format(time.Stamp)
 	},
+	"groupOf": groupOf,
 	"runtime": func(job *jobInformation) string {
 		if job.StartedAt.IsZero() || job.StoppedAt.IsZero() {
 			return "-"
@@ -192,37 +439,90 @@ var templateViewJobs = template.Must(template.New("viewJobs").Funcs(template.Fun
 
 		return job.StoppedAt.Sub(job.StartedAt).Truncate(time.Millisecond).String()
 	},
-}).Parse(rawTemplateViewJobs))
+}).Parse(rawTemplateJobOptions + rawTemplateGroupActions + rawTemplateJobRow + rawTemplateViewJobs))
 
 func handlerViewJobs(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "text/html")
 
-	jobRepo.lock.RLock()
-	defer jobRepo.lock.RUnlock()
-
-	jobs := make([]*jobInformation, len(jobRepo.jobs))
-
-	i := 0
-	for _, job := range jobRepo.jobs {
-		job.lock.RLock()
-		jobs[i] = job
-		defer job.lock.RUnlock()
-		i++
-	}
+	user := requestUser(r)
+	onlyMine := r.URL.Query().Get("mine") != ""
 
-	sort.Slice(jobs, func(i, j int) bool {
-		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	jobs, unlock := jobRepo.RLockMatching(func(job *jobInformation) bool {
+		return canSeeJob(user, onlyMine, job)
 	})
+	defer unlock()
 
 	err := templateViewJobs.Execute(w, struct {
-		Jobs []*jobInformation
-	}{jobs})
+		Jobs                 []*jobNode
+		IsAdmin              bool
+		OnlyMine             bool
+		DownloadWindows      []creamqueue.DownloadWindow
+		FormatProfiles       []string
+		DefaultFormatProfile string
+		RecodeProfiles       []string
+		DefaultRecodeProfile string
+	}{buildJobTree(jobs), isAdmin(user), onlyMine, config.downloadWindows, formatProfileNames(), config.defaultFormatProfile, recodeProfileNames(), config.defaultRecodeProfile})
 
 	if err != nil {
 		log.Println("error rendering viewJobs template:", err)
 	}
 }
 
+// jobDataFromForm reads the job options shared by every form that queues jobs.
+// The URL is left empty.
+func jobDataFromForm(r *http.Request) (creamqueue.JobData, error) {
+	rawTags := r.FormValue("tags")
+	var tags []string
+	if rawTags == "" {
+		tags = []string{}
+	} else {
+		tags = strings.Split(rawTags, ",")
+	}
+
+	priority, err := creamqueue.ParseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		return creamqueue.JobData{}, err
+	}
+
+	var notBefore time.Time
+	if rawNotBefore := r.FormValue("not_before"); rawNotBefore != "" {
+		notBefore, err = time.ParseInLocation("2006-01-02T15:04", rawNotBefore, time.Local)
+		if err != nil {
+			return creamqueue.JobData{}, errors.New("invalid \"not_before\" value")
+		}
+	}
+
+	playlist, err := playlistOptionsFromForm(r)
+	if err != nil {
+		return creamqueue.JobData{}, err
+	}
+
+	data := creamqueue.JobData{
+		Tags:             tags,
+		SubmittedBy:      requestUser(r),
+		Priority:         priority,
+		NotBefore:        notBefore,
+		InDownloadWindow: r.FormValue("in_download_window") != "",
+
+		TitleTemplate:       r.FormValue("title_template"),
+		DescriptionTemplate: r.FormValue("description_template"),
+		FormatProfile:       r.FormValue("format_profile"),
+		RecodeProfile:       r.FormValue("recode_profile"),
+
+		SubtitleLanguages: parseSubtitleLanguages(r.FormValue("subtitle_languages")),
+		AutoSubtitles:     r.FormValue("auto_subtitles") != "",
+		SplitChapters:     r.FormValue("split_chapters") != "",
+
+		Playlist: playlist,
+	}
+
+	if err := validateJobOptions(&data); err != nil {
+		return creamqueue.JobData{}, err
+	}
+
+	return data, nil
+}
+
 func handlerCreateJob(w http.ResponseWriter, r *http.Request) {
 	if err := r.ParseForm(); err != nil {
 		w.WriteHeader(400)
@@ -237,18 +537,47 @@ func handlerCreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rawTags := r.FormValue("tags")
-	var tags []string
-	if rawTags == "" {
-		tags = []string{}
-	} else {
-		tags = strings.Split(rawTags, ",")
+	data, err := jobDataFromForm(r)
+	if err != nil {
+		w.WriteHeader(422)
+		w.Write([]byte(err.Error()))
+		return
 	}
 
-	queue.Push(idGenerator.Next(), creamqueue.JobData{
-		URL:  url,
-		Tags: tags,
-	})
+	data.URL = url
+	queueJob(data)
+
+	http.Redirect(w, r, "/", 302)
+}
+
+func handlerChangeJobPriority(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte("bad data"))
+		return
+	}
+
+	priority, err := creamqueue.ParseJobPriority(r.FormValue("priority"))
+	if err != nil {
+		w.WriteHeader(422)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	id := creamqueue.JobID(mux.Vars(r)["id"])
+	if !canManageJob(requestUser(r), id) {
+		w.WriteHeader(404)
+		w.Write([]byte("job not found"))
+		return
+	}
+
+	if !updateWaitingJob(id, func(data *creamqueue.JobData) {
+		data.Priority = priority
+	}) {
+		w.WriteHeader(409)
+		w.Write([]byte("job is no longer waiting"))
+		return
+	}
 
 	http.Redirect(w, r, "/", 302)
 }
@@ -257,7 +586,22 @@ func bootServer(ctx context.Context) chan error {
 	router := makeRouter([]routeDef{
 		routeDef{"GET", "/", "ViewJobs", handlerViewJobs},
 		routeDef{"POST", "/", "CreateJob", handlerCreateJob},
+		routeDef{"POST", "/preview", "PreviewJob", handlerPreviewJob},
+		routeDef{"POST", "/bulk", "CreateJobsInBulk", handlerCreateJobsInBulk},
+		routeDef{"POST", "/upload", "CreateJobFromUpload", handlerCreateJobFromUpload},
+		routeDef{"POST", "/jobs/{id}/priority", "ChangeJobPriority", handlerChangeJobPriority},
+		routeDef{"POST", "/groups/{kind}/{key}/{action}", "GroupAction", handlerGroupAction},
+		routeDef{"GET", "/api/jobs", "APIListJobs", handlerAPIListJobs},
+		routeDef{"POST", "/api/jobs", "APICreateJob", handlerAPICreateJob},
+		routeDef{"POST", "/api/jobs/preview", "APIPreviewJob", handlerAPIPreviewJob},
+		routeDef{"POST", "/api/jobs/bulk", "APICreateJobsInBulk", handlerAPICreateJobsInBulk},
+		routeDef{"POST", "/api/jobs/upload", "APICreateJobFromUpload", handlerAPICreateJobFromUpload},
+		routeDef{"POST", "/api/jobs/{id}/priority", "APIChangeJobPriority", handlerAPIChangeJobPriority},
+		routeDef{"POST", "/api/groups/{kind}/{key}/{action}", "APIGroupAction", handlerAPIGroupAction},
+		routeDef{"POST", "/api/archives/import", "APIImportArchive", handlerAPIImportArchive},
+		routeDef{"POST", "/api/rules/dry-run", "APIDryRunRules", handlerAPIDryRunRules},
 	})
+	router.Use(requireUser)
 
 	src := &http.Server{
 		Addr:    ":" + config.port,
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+// localFileURL is used as the URL of jobs importing a file from disk
+func localFileURL(path string) string {
+	if absolute, err := filepath.Abs(path); err == nil {
+		path = absolute
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// localEntry describes a file on disk the way yt-dlp would,
+// or reads what yt-dlp said about it when it was downloaded
+func localEntry(ctx context.Context, jobData *creamqueue.JobData) (ytdlwrapper.Entry, error) {
+	if jobData.LocalInfoPath != "" {
+		entry, err := ytdlwrapper.ReadInfoFile(jobData.LocalInfoPath)
+		if err != nil {
+			return ytdlwrapper.Entry{}, err
+		}
+		return *entry, nil
+	}
+
+	name := filepath.Base(jobData.LocalPath)
+	entry := ytdlwrapper.Entry{
+		Title:     strings.TrimSuffix(name, filepath.Ext(name)),
+		Extractor: jobData.LocalSource,
+	}
+
+	// rules and thumbnails like knowing the duration, but can do without
+	if probed, err := ffmpegwrapper.Make().Probe(ctx, jobData.LocalPath); err == nil {
+		entry.Duration = probed.Duration
+	}
+
+	return entry, nil
+}
+
+// processLocalJob imports a file that is on disk already, skipping yt-dlp
+func processLocalJob(ctx context.Context, job creamqueue.QueuedJob) {
+	jobData := job.Data()
+
+	job.Progress(creamqueue.JobProgress("Checking file"))
+	if _, err := os.Stat(jobData.LocalPath); err != nil {
+		job.Progress(creamqueue.JobProgress("Failed reading file"))
+		job.Failed(&creamqueue.JobFailure{
+			Error: err,
+		})
+		return
+	}
+
+	if config.thumbnails {
+		defer removeThumbnails(job.ID())
+	}
+
+	entry, err := localEntry(ctx, jobData)
+	if err != nil {
+		job.Progress(creamqueue.JobProgress("Failed reading info file"))
+		job.Failed(&creamqueue.JobFailure{
+			Error: err,
+		})
+		return
+	}
+	rules := tagRules.Apply(&entry, importTags(jobData, &entry))
+
+	metadata, err := buildImportMetadata(jobData, &entry, time.Now())
+	if err != nil {
+		job.Progress(creamqueue.JobProgress("Failed building title and description"))
+		job.Failed(&creamqueue.JobFailure{
+			Error: err,
+		})
+		return
+	}
+
+	importFile(ctx, job, &entry, jobData.LocalPath, rules.Tags, metadata, false)
+}
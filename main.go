@@ -5,22 +5,53 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/AlbinoDrought/creamy-videos-importer/autoid"
 	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/tagrules"
+	"github.com/dustin/go-humanize"
 )
 
-var queue creamqueue.Queue
+var queue creamqueue.MutableQueue
 var idGenerator autoid.AutoID
 var jobRepo *jobRepository
+var tagRules *tagrules.Engine
+var metadataTags tagrules.MetadataMapping
+var tagNormalizer *tagrules.Normalizer
+var titleTemplate *template.Template
+var descriptionTemplate *template.Template
+var formatProfiles map[string]formatProfile
+var recodeProfiles map[string]recodeProfile
 
 var config = struct {
 	creamyVideosHost string
 	port             string
 	parallelWorkers  int
 	keepJobsFor      time.Duration
+
+	downloadWindows []creamqueue.DownloadWindow
+
+	defaultFormatProfile string
+	defaultRecodeProfile string
+
+	userHeader   string
+	adminUsers   []string
+	tagSubmitter bool
+	thumbnails   bool
+	subtitles    subtitleConfig
+	watchFolders []watchFolder
+
+	stagingDir    string
+	maxUploadSize int64
+
+	maxPlaylistDepth  int
+	playlistBatchSize int
 }{}
 
 func envDefault(name string, backup string) string {
@@ -31,8 +62,99 @@ func envDefault(name string, backup string) string {
 	return backup
 }
 
+func envList(name string) []string {
+	list := []string{}
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func envBool(name string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(name))
+	return value
+}
+
 func main() {
-	queue = creamqueue.MakeBarebonesQueue()
+	downloadWindows, err := creamqueue.ParseDownloadWindows(os.Getenv("CREAMY_DOWNLOAD_WINDOWS"))
+	if err != nil {
+		log.Fatalln("invalid CREAMY_DOWNLOAD_WINDOWS:", err)
+	}
+	config.downloadWindows = downloadWindows
+
+	loadedConfig, err := loadConfigFile(os.Getenv("CREAMY_CONFIG_FILE"))
+	if err != nil {
+		log.Fatalln("failed loading CREAMY_CONFIG_FILE:", err)
+	}
+
+	metadataTags = loadedConfig.MetadataTags
+	tagNormalizer = tagrules.MakeNormalizer(loadedConfig.TagNormalization)
+
+	tagRules, err = tagrules.Make(loadedConfig.Rules, tagNormalizer)
+	if err != nil {
+		log.Fatalln("invalid tag rules:", err)
+	}
+
+	formatProfiles = map[string]formatProfile{}
+	for name, profile := range builtinFormatProfiles {
+		formatProfiles[name] = profile
+	}
+	for name, profile := range loadedConfig.FormatProfiles {
+		formatProfiles[name] = profile
+	}
+
+	config.defaultFormatProfile = loadedConfig.DefaultFormatProfile
+	if err := validateFormatProfile(config.defaultFormatProfile); err != nil {
+		log.Fatalln("invalid default_format_profile:", err)
+	}
+	for _, name := range tagRules.FormatProfiles() {
+		if err := validateFormatProfile(name); err != nil {
+			log.Fatalln("invalid tag rules:", err)
+		}
+	}
+
+	recodeProfiles = map[string]recodeProfile{}
+	for name, profile := range builtinRecodeProfiles {
+		recodeProfiles[name] = profile
+	}
+	for name, profile := range loadedConfig.RecodeProfiles {
+		if err := profile.validate(); err != nil {
+			log.Fatalf("invalid recode profile %q: %v", name, err)
+		}
+		recodeProfiles[name] = profile
+	}
+
+	config.defaultRecodeProfile = loadedConfig.DefaultRecodeProfile
+	if err := validateRecodeProfile(config.defaultRecodeProfile); err != nil {
+		log.Fatalln("invalid default_recode_profile:", err)
+	}
+
+	config.subtitles = loadedConfig.Subtitles
+	if err := config.subtitles.validate(); err != nil {
+		log.Fatalln("invalid subtitles:", err)
+	}
+
+	config.watchFolders = loadedConfig.WatchFolders
+	for _, folder := range config.watchFolders {
+		if stat, err := os.Stat(folder.Path); err != nil || !stat.IsDir() {
+			log.Fatalln("invalid watch folder:", folder.Path, "is not a directory")
+		}
+	}
+
+	titleTemplate, err = parseMetadataTemplate("title", loadedConfig.TitleTemplate)
+	if err != nil {
+		log.Fatalln("invalid title template:", err)
+	}
+
+	descriptionTemplate, err = parseMetadataTemplate("description", loadedConfig.DescriptionTemplate)
+	if err != nil {
+		log.Fatalln("invalid description template:", err)
+	}
+
+	queue = creamqueue.MakeHeapQueue(config.downloadWindows)
 	idGenerator = autoid.Make()
 	jobRepo = makeJobRepository()
 
@@ -40,6 +162,25 @@ func main() {
 	config.port = envDefault("CREAMY_HTTP_PORT", "4000")
 	config.parallelWorkers = 3
 	config.keepJobsFor = time.Hour
+	config.userHeader = os.Getenv("CREAMY_HTTP_USER_HEADER")
+	config.adminUsers = envList("CREAMY_ADMIN_USERS")
+	config.tagSubmitter = envBool("CREAMY_TAG_SUBMITTER")
+	config.thumbnails = envBool("CREAMY_THUMBNAILS")
+	config.stagingDir = filepath.Clean(envDefault("CREAMY_STAGING_DIR", "staging"))
+	maxUploadSize, err := humanize.ParseBytes(envDefault("CREAMY_MAX_UPLOAD_SIZE", "4GB"))
+	if err != nil {
+		log.Fatalln("invalid CREAMY_MAX_UPLOAD_SIZE:", err)
+	}
+	config.maxUploadSize = int64(maxUploadSize)
+	cleanStaging(config.stagingDir)
+	config.maxPlaylistDepth, err = strconv.Atoi(envDefault("CREAMY_MAX_PLAYLIST_DEPTH", "1"))
+	if err != nil || config.maxPlaylistDepth < 0 {
+		log.Fatalln("invalid CREAMY_MAX_PLAYLIST_DEPTH:", os.Getenv("CREAMY_MAX_PLAYLIST_DEPTH"))
+	}
+	config.playlistBatchSize, err = strconv.Atoi(envDefault("CREAMY_PLAYLIST_BATCH_SIZE", "10"))
+	if err != nil || config.playlistBatchSize < 1 {
+		log.Fatalln("invalid CREAMY_PLAYLIST_BATCH_SIZE:", os.Getenv("CREAMY_PLAYLIST_BATCH_SIZE"))
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -53,6 +194,13 @@ func main() {
 		gracefulWaitGroup.Done()
 	}()
 
+	watchersFinished := bootWatchFolders(ctx, config.watchFolders)
+	gracefulWaitGroup.Add(1)
+	go func() {
+		<-watchersFinished
+		gracefulWaitGroup.Done()
+	}()
+
 	serverFinished := bootServer(ctx)
 	gracefulWaitGroup.Add(1)
 	go func() {
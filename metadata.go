@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+const defaultTitleTemplate = `{{ if .Entry.Title }}{{ .Entry.Title }}{{ else }}Import of {{ .URL }}{{ end }}{{ with .Chapter }} - {{ .Title }}{{ end }}`
+
+const defaultDescriptionTemplate = `Original URL: {{ .URL }}{{ if .Entry.Description }}
+
+{{ .Entry.Description }}{{ end }}{{ if .Entry.Chapters }}
+
+Chapters:
+{{ chapters .Entry.Chapters }}{{ end }}`
+
+// formatDuration formats seconds like 1:02:03
+func formatDuration(seconds float64) string {
+	total := int(seconds)
+	if total >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", total/3600, total/60%60, total%60)
+	}
+	return fmt.Sprintf("%d:%02d", total/60, total%60)
+}
+
+var metadataTemplateFuncs = template.FuncMap{
+	// duration formats seconds like 1:02:03
+	"duration": formatDuration,
+	// chapters lists chapters one per line, like "1:02 Intro"
+	"chapters": func(chapters []ytdlwrapper.Chapter) string {
+		lines := make([]string, len(chapters))
+		for i, chapter := range chapters {
+			lines[i] = formatDuration(chapter.StartTime) + " " + chapter.Title
+		}
+		return strings.Join(lines, "\n")
+	},
+	// date formats yt-dlp's YYYYMMDD dates like 2006-01-02
+	"date": func(raw string) string {
+		parsed, err := time.Parse("20060102", raw)
+		if err != nil {
+			return raw
+		}
+		return parsed.Format("2006-01-02")
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+}
+
+// metadataTemplateData is what title and description templates can access
+type metadataTemplateData struct {
+	// URL is the URL the job was queued with
+	URL      string
+	Entry    ytdlwrapper.Entry
+	Job      creamqueue.JobData
+	Playlist metadataTemplatePlaylist
+	// Chapter is only set when uploading a single chapter of the video
+	Chapter    *metadataTemplateChapter
+	ImportedAt time.Time
+}
+
+type metadataTemplatePlaylist struct {
+	ID        string
+	Extractor string
+	Title     string
+	// Index is the 1-based position of the video in the playlist
+	Index int
+}
+
+type metadataTemplateChapter struct {
+	ytdlwrapper.Chapter
+	// Index starts at 1
+	Index int
+	Count int
+}
+
+func parseMetadataTemplate(name, raw string) (*template.Template, error) {
+	return template.New(name).Funcs(metadataTemplateFuncs).Parse(raw)
+}
+
+// validateMetadataTemplates checks per-job templates before the job is queued
+func validateMetadataTemplates(data *creamqueue.JobData) error {
+	if _, err := parseMetadataTemplate("title", data.TitleTemplate); err != nil {
+		return fmt.Errorf("invalid title template: %w", err)
+	}
+	if _, err := parseMetadataTemplate("description", data.DescriptionTemplate); err != nil {
+		return fmt.Errorf("invalid description template: %w", err)
+	}
+	return nil
+}
+
+func renderMetadataTemplate(globalTemplate *template.Template, jobTemplate string, data *metadataTemplateData) (string, error) {
+	tmpl := globalTemplate
+	if jobTemplate != "" {
+		var err error
+		tmpl, err = parseMetadataTemplate(globalTemplate.Name(), jobTemplate)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	buffer := bytes.Buffer{}
+	if err := tmpl.Execute(&buffer, data); err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+// buildMetadata renders the title and description of an imported video,
+// using the job's templates if set and the configured ones otherwise.
+// chapter is nil unless a single chapter is being uploaded.
+func buildMetadata(jobData *creamqueue.JobData, entry *ytdlwrapper.Entry, chapter *metadataTemplateChapter, importedAt time.Time) (string, string, error) {
+	data := &metadataTemplateData{
+		URL:   jobData.URL,
+		Entry: *entry,
+		Job:   *jobData,
+		Playlist: metadataTemplatePlaylist{
+			ID:        jobData.ParentPlaylistID,
+			Extractor: jobData.ParentPlaylistExtractor,
+			Title:     jobData.PlaylistTitle,
+			Index:     jobData.PlaylistIndex,
+		},
+		Chapter:    chapter,
+		ImportedAt: importedAt,
+	}
+
+	title, err := renderMetadataTemplate(titleTemplate, jobData.TitleTemplate, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed rendering title: %w", err)
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "Import of " + jobData.URL
+	}
+
+	description, err := renderMetadataTemplate(descriptionTemplate, jobData.DescriptionTemplate, data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed rendering description: %w", err)
+	}
+
+	return title, description, nil
+}
+
+// videoMetadata is the title and description a video is uploaded with
+type videoMetadata struct {
+	Title       string
+	Description string
+}
+
+// importMetadata is everything a job uploads rendered from templates
+type importMetadata struct {
+	// videoMetadata is only set if the video is uploaded as a whole
+	videoMetadata
+	// Chapters are only set if the chapters are uploaded on their own instead
+	Chapters []videoMetadata
+}
+
+// splitsChapters checks if the video is uploaded one chapter at a time
+func splitsChapters(jobData *creamqueue.JobData, entry *ytdlwrapper.Entry) bool {
+	return jobData.SplitChapters && len(entry.Chapters) > 1
+}
+
+// buildImportMetadata renders the title and description of the video, or of
+// each of its chapters if they are uploaded on their own. It runs before the
+// video is downloaded, so a failing template doesn't waste a download.
+func buildImportMetadata(jobData *creamqueue.JobData, entry *ytdlwrapper.Entry, importedAt time.Time) (importMetadata, error) {
+	metadata := importMetadata{}
+
+	var err error
+	if !splitsChapters(jobData, entry) {
+		metadata.Title, metadata.Description, err = buildMetadata(jobData, entry, nil, importedAt)
+		return metadata, err
+	}
+
+	count := len(entry.Chapters)
+	metadata.Chapters = make([]videoMetadata, count)
+	for i, chapter := range entry.Chapters {
+		templateChapter := &metadataTemplateChapter{
+			Chapter: chapter,
+			Index:   i + 1,
+			Count:   count,
+		}
+
+		chapterMetadata := &metadata.Chapters[i]
+		chapterMetadata.Title, chapterMetadata.Description, err = buildMetadata(jobData, entry, templateChapter, importedAt)
+		if err != nil {
+			return importMetadata{}, fmt.Errorf("chapter %v: %w", i+1, err)
+		}
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/tagrules"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+// useTestTagging resets the tag rules, metadata tags and templates to their defaults,
+// putting the previous ones back once the test is done
+func useTestTagging(t *testing.T) {
+	t.Helper()
+
+	previousNormalizer, previousRules, previousMetadataTags := tagNormalizer, tagRules, metadataTags
+	previousTitle, previousDescription, previousConfig := titleTemplate, descriptionTemplate, config
+	t.Cleanup(func() {
+		tagNormalizer, tagRules, metadataTags = previousNormalizer, previousRules, previousMetadataTags
+		titleTemplate, descriptionTemplate, config = previousTitle, previousDescription, previousConfig
+	})
+
+	var err error
+	tagNormalizer = tagrules.MakeNormalizer(tagrules.Normalization{})
+	metadataTags = tagrules.MetadataMapping{}
+	if tagRules, err = tagrules.Make([]tagrules.Rule{}, tagNormalizer); err != nil {
+		t.Fatal(err)
+	}
+	if titleTemplate, err = parseMetadataTemplate("title", defaultTitleTemplate); err != nil {
+		t.Fatal(err)
+	}
+	if descriptionTemplate, err = parseMetadataTemplate("description", defaultDescriptionTemplate); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_buildMetadata(t *testing.T) {
+	useTestTagging(t)
+
+	importedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := ytdlwrapper.Entry{
+		Title:       "Big Buck Bunny",
+		Uploader:    "Blender",
+		Description: "A big bunny",
+		UploadDate:  "20080410",
+		Duration:    596,
+	}
+
+	tests := []struct {
+		name            string
+		jobData         creamqueue.JobData
+		entry           ytdlwrapper.Entry
+		chapter         *metadataTemplateChapter
+		wantTitle       string
+		wantDescription string
+	}{
+		{
+			name:            "defaults",
+			jobData:         creamqueue.JobData{URL: "https://example.com/bunny"},
+			entry:           entry,
+			wantTitle:       "Big Buck Bunny",
+			wantDescription: "Original URL: https://example.com/bunny\n\nA big bunny",
+		},
+		{
+			name:            "defaults without metadata",
+			jobData:         creamqueue.JobData{URL: "https://example.com/bunny.mp4"},
+			entry:           ytdlwrapper.Entry{},
+			wantTitle:       "Import of https://example.com/bunny.mp4",
+			wantDescription: "Original URL: https://example.com/bunny.mp4",
+		},
+		{
+			name: "job templates",
+			jobData: creamqueue.JobData{
+				URL:                 "https://example.com/bunny",
+				ParentPlaylistID:    "PL123",
+				TitleTemplate:       "{{ .Entry.Uploader }}: {{ .Entry.Title }}",
+				DescriptionTemplate: "{{ date .Entry.UploadDate }} ({{ duration .Entry.Duration }}) from {{ .Playlist.ID }}, imported {{ .ImportedAt.Format \"2006-01-02\" }}",
+			},
+			entry:           entry,
+			wantTitle:       "Blender: Big Buck Bunny",
+			wantDescription: "2008-04-10 (9:56) from PL123, imported 2026-01-02",
+		},
+		{
+			name: "playlist position and series",
+			jobData: creamqueue.JobData{
+				URL:                 "https://example.com/bunny",
+				ParentPlaylistID:    "PL123",
+				PlaylistIndex:       12,
+				PlaylistTitle:       "Open Movies",
+				TitleTemplate:       "{{ .Entry.Series }} S{{ .Entry.SeasonNumber }}E{{ .Entry.EpisodeNumber }}",
+				DescriptionTemplate: "#{{ .Playlist.Index }} of {{ .Playlist.Title }}",
+			},
+			entry:           ytdlwrapper.Entry{Series: "Blender Open Movies", SeasonNumber: 1, EpisodeNumber: 3},
+			wantTitle:       "Blender Open Movies S1E3",
+			wantDescription: "#12 of Open Movies",
+		},
+		{
+			name:    "chapters",
+			jobData: creamqueue.JobData{URL: "https://example.com/bunny"},
+			entry: ytdlwrapper.Entry{
+				Title: "Big Buck Bunny",
+				Chapters: []ytdlwrapper.Chapter{
+					{StartTime: 0, EndTime: 62, Title: "Intro"},
+					{StartTime: 62, EndTime: 596, Title: "The Bunny"},
+				},
+			},
+			chapter: &metadataTemplateChapter{
+				Chapter: ytdlwrapper.Chapter{StartTime: 62, EndTime: 596, Title: "The Bunny"},
+				Index:   2,
+				Count:   2,
+			},
+			wantTitle:       "Big Buck Bunny - The Bunny",
+			wantDescription: "Original URL: https://example.com/bunny\n\nChapters:\n0:00 Intro\n1:02 The Bunny",
+		},
+		{
+			name: "blank title falls back",
+			jobData: creamqueue.JobData{
+				URL:           "https://example.com/bunny",
+				TitleTemplate: "{{ .Entry.Series }}",
+			},
+			entry:           entry,
+			wantTitle:       "Import of https://example.com/bunny",
+			wantDescription: "Original URL: https://example.com/bunny\n\nA big bunny",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, description, err := buildMetadata(&tt.jobData, &tt.entry, tt.chapter, importedAt)
+			if err != nil {
+				t.Fatalf("buildMetadata() error = %v", err)
+			}
+			if title != tt.wantTitle {
+				t.Errorf("buildMetadata() title = %q, want %q", title, tt.wantTitle)
+			}
+			if description != tt.wantDescription {
+				t.Errorf("buildMetadata() description = %q, want %q", description, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func Test_buildImportMetadata(t *testing.T) {
+	useTestTagging(t)
+
+	importedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entry := ytdlwrapper.Entry{
+		Title: "Album",
+		Chapters: []ytdlwrapper.Chapter{
+			{StartTime: 0, EndTime: 10, Title: "One"},
+			{StartTime: 10, EndTime: 20, Title: "Two"},
+		},
+	}
+
+	jobData := creamqueue.JobData{URL: "https://example.com/album", TitleTemplate: "{{ .Chapter.Index }}. {{ .Chapter.Title }}", SplitChapters: true}
+	metadata, err := buildImportMetadata(&jobData, &entry, importedAt)
+	if err != nil {
+		t.Fatalf("buildImportMetadata() error = %v", err)
+	}
+	if len(metadata.Chapters) != 2 || metadata.Chapters[0].Title != "1. One" || metadata.Chapters[1].Title != "2. Two" {
+		t.Errorf("buildImportMetadata() chapters = %+v, want one per chapter", metadata.Chapters)
+	}
+
+	// fails before anything would be downloaded
+	jobData = creamqueue.JobData{URL: "https://example.com/album", TitleTemplate: "{{ index .Entry.Tags 3 }}"}
+	if _, err := buildImportMetadata(&jobData, &entry, importedAt); err == nil {
+		t.Error("buildImportMetadata() error = nil, want the failing title template")
+	}
+}
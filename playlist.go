@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+// playlistItemRange is an inclusive range of 1-based positions, end 0 is open-ended
+type playlistItemRange struct {
+	start int
+	end   int
+}
+
+// parsePlaylistItems parses lists like "1-20,25,30-"
+func parsePlaylistItems(raw string) ([]playlistItemRange, error) {
+	ranges := []playlistItemRange{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		invalid := fmt.Errorf("invalid playlist item %q, expected a position like 5 or a range like 1-20", part)
+
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || start < 1 {
+			return nil, invalid
+		}
+
+		end := start
+		if len(bounds) == 2 {
+			if rawEnd := strings.TrimSpace(bounds[1]); rawEnd == "" {
+				end = 0
+			} else if end, err = strconv.Atoi(rawEnd); err != nil || end < start {
+				return nil, invalid
+			}
+		}
+
+		ranges = append(ranges, playlistItemRange{start, end})
+	}
+	return ranges, nil
+}
+
+func (itemRange playlistItemRange) contains(position int) bool {
+	return position >= itemRange.start && (itemRange.end == 0 || position <= itemRange.end)
+}
+
+// normalizePlaylistDate accepts YYYYMMDD like yt-dlp and YYYY-MM-DD like date inputs
+func normalizePlaylistDate(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	for _, layout := range []string{"20060102", "2006-01-02"} {
+		if parsed, err := time.Parse(layout, raw); err == nil {
+			return parsed.Format("20060102"), nil
+		}
+	}
+	return "", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", raw)
+}
+
+// validatePlaylistOptions checks the options and normalizes their dates
+func validatePlaylistOptions(options *creamqueue.PlaylistOptions) error {
+	if _, err := parsePlaylistItems(options.Items); err != nil {
+		return err
+	}
+
+	var err error
+	if options.DateAfter, err = normalizePlaylistDate(options.DateAfter); err != nil {
+		return err
+	}
+	if options.DateBefore, err = normalizePlaylistDate(options.DateBefore); err != nil {
+		return err
+	}
+
+	if _, err := regexp.Compile(options.TitleInclude); err != nil {
+		return fmt.Errorf("invalid title include pattern: %w", err)
+	}
+	if _, err := regexp.Compile(options.TitleExclude); err != nil {
+		return fmt.Errorf("invalid title exclude pattern: %w", err)
+	}
+
+	if options.Last < 0 || options.Max < 0 || options.MinDuration < 0 || options.MaxDuration < 0 {
+		return errors.New("playlist limits can't be negative")
+	}
+
+	return nil
+}
+
+// selectPlaylistEntries returns the entries the options pick, in the order they should be queued.
+// Positions are picked first, then entries are filtered, reversed and capped.
+func selectPlaylistEntries(entries []ytdlwrapper.Entry, options *creamqueue.PlaylistOptions) ([]ytdlwrapper.Entry, error) {
+	ranges, err := parsePlaylistItems(options.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	var include, exclude *regexp.Regexp
+	if options.TitleInclude != "" {
+		if include, err = regexp.Compile(options.TitleInclude); err != nil {
+			return nil, err
+		}
+	}
+	if options.TitleExclude != "" {
+		if exclude, err = regexp.Compile(options.TitleExclude); err != nil {
+			return nil, err
+		}
+	}
+
+	first := 0
+	if options.Last > 0 && options.Last < len(entries) {
+		first = len(entries) - options.Last
+	}
+
+	selected := []ytdlwrapper.Entry{}
+	for i := first; i < len(entries); i++ {
+		entry := entries[i]
+		if entry.PlaylistIndex == 0 {
+			entry.PlaylistIndex = i + 1
+		}
+
+		if len(ranges) > 0 {
+			inRange := false
+			for _, itemRange := range ranges {
+				if itemRange.contains(i + 1) {
+					inRange = true
+					break
+				}
+			}
+			if !inRange {
+				continue
+			}
+		}
+
+		// YYYYMMDD sorts like the date it is
+		if entry.UploadDate != "" {
+			if options.DateAfter != "" && entry.UploadDate < options.DateAfter {
+				continue
+			}
+			if options.DateBefore != "" && entry.UploadDate > options.DateBefore {
+				continue
+			}
+		}
+
+		// nested playlists are titled like "Channel - Videos",
+		// their videos are filtered once they are expanded
+		if !entry.IsPlaylist() {
+			if include != nil && !include.MatchString(entry.Title) {
+				continue
+			}
+			if exclude != nil && exclude.MatchString(entry.Title) {
+				continue
+			}
+		}
+
+		if entry.Duration > 0 {
+			if options.MinDuration > 0 && entry.Duration < options.MinDuration {
+				continue
+			}
+			if options.MaxDuration > 0 && entry.Duration > options.MaxDuration {
+				continue
+			}
+		}
+
+		selected = append(selected, entry)
+	}
+
+	if options.Reverse {
+		for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+			selected[i], selected[j] = selected[j], selected[i]
+		}
+	}
+
+	if options.Max > 0 && len(selected) > options.Max {
+		selected = selected[:options.Max]
+	}
+
+	return selected, nil
+}
+
+// nestedPlaylistOptions returns the options passed on to the videos of a playlist.
+// Positions and counts picked the video, they don't apply to what it contains,
+// but the filters do, like the filters of a channel applying to its tabs.
+func nestedPlaylistOptions(options *creamqueue.PlaylistOptions) creamqueue.PlaylistOptions {
+	return creamqueue.PlaylistOptions{
+		DateAfter:    options.DateAfter,
+		DateBefore:   options.DateBefore,
+		TitleInclude: options.TitleInclude,
+		TitleExclude: options.TitleExclude,
+		MinDuration:  options.MinDuration,
+		MaxDuration:  options.MaxDuration,
+	}
+}
+
+// playlistOptionsFromForm reads the "playlist_" fields of a form
+func playlistOptionsFromForm(r *http.Request) (creamqueue.PlaylistOptions, error) {
+	options := creamqueue.PlaylistOptions{
+		Items:        r.FormValue("playlist_items"),
+		Reverse:      r.FormValue("playlist_reverse") != "",
+		DateAfter:    r.FormValue("playlist_date_after"),
+		DateBefore:   r.FormValue("playlist_date_before"),
+		TitleInclude: r.FormValue("playlist_title_include"),
+		TitleExclude: r.FormValue("playlist_title_exclude"),
+	}
+
+	for field, target := range map[string]*int{
+		"playlist_last": &options.Last,
+		"playlist_max":  &options.Max,
+	} {
+		if raw := strings.TrimSpace(r.FormValue(field)); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return options, fmt.Errorf("invalid %q value", field)
+			}
+			*target = value
+		}
+	}
+
+	for field, target := range map[string]*float64{
+		"playlist_min_duration": &options.MinDuration,
+		"playlist_max_duration": &options.MaxDuration,
+	} {
+		if raw := strings.TrimSpace(r.FormValue(field)); raw != "" {
+			value, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return options, fmt.Errorf("invalid %q value", field)
+			}
+			*target = value
+		}
+	}
+
+	return options, nil
+}
+
+// playlistRef identifies the playlist expanded from the URL
+func playlistRef(playlist *ytdlwrapper.Playlist, url string) creamqueue.PlaylistRef {
+	if playlist.WebpageURL != "" {
+		url = playlist.WebpageURL
+	}
+	return creamqueue.PlaylistRef{
+		ID:        playlist.ID,
+		Extractor: playlist.Extractor,
+		URL:       url,
+	}
+}
+
+// samePlaylist returns true if both refs point at the same playlist.
+// Channel tabs share the ID of their channel, so the URL is compared too when both are known.
+func samePlaylist(a, b creamqueue.PlaylistRef) bool {
+	if a.ID != b.ID || a.Extractor != b.Extractor {
+		return false
+	}
+	return a.URL == "" || b.URL == "" || a.URL == b.URL
+}
+
+// checkPlaylistNesting returns an error if the playlist is nested too deep
+// in its ancestry, or if it is one of its own ancestors
+func checkPlaylistNesting(ancestry []creamqueue.PlaylistRef, playlist creamqueue.PlaylistRef, maxDepth int) error {
+	for _, ancestor := range ancestry {
+		if samePlaylist(ancestor, playlist) {
+			return fmt.Errorf("playlist %v %v contains itself, aborting", playlist.Extractor, playlist.ID)
+		}
+	}
+
+	if len(ancestry) > maxDepth {
+		parent := ancestry[len(ancestry)-1]
+		return fmt.Errorf(
+			"playlist %v found in playlist %v is nested %v levels deep, more than the maximum of %v, aborting",
+			playlist.ID,
+			parent.ID,
+			len(ancestry),
+			maxDepth,
+		)
+	}
+
+	return nil
+}
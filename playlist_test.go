@@ -0,0 +1,256 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+func Test_parsePlaylistItems(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []playlistItemRange
+		wantErr bool
+	}{
+		{"", []playlistItemRange{}, false},
+		{"5", []playlistItemRange{{5, 5}}, false},
+		{"1-20, 25,30-", []playlistItemRange{{1, 20}, {25, 25}, {30, 0}}, false},
+		{"0", nil, true},
+		{"20-1", nil, true},
+		{"-5", nil, true},
+		{"a-b", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := parsePlaylistItems(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePlaylistItems() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePlaylistItems() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validatePlaylistOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options creamqueue.PlaylistOptions
+		want    creamqueue.PlaylistOptions
+		wantErr bool
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:    "dates are normalized",
+			options: creamqueue.PlaylistOptions{DateAfter: "2020-01-02", DateBefore: "20201231"},
+			want:    creamqueue.PlaylistOptions{DateAfter: "20200102", DateBefore: "20201231"},
+		},
+		{
+			name:    "bad date",
+			options: creamqueue.PlaylistOptions{DateAfter: "yesterday"},
+			wantErr: true,
+		},
+		{
+			name:    "bad pattern",
+			options: creamqueue.PlaylistOptions{TitleInclude: "("},
+			wantErr: true,
+		},
+		{
+			name:    "negative cap",
+			options: creamqueue.PlaylistOptions{Max: -1},
+			wantErr: true,
+		},
+		{
+			name:    "bad items",
+			options: creamqueue.PlaylistOptions{Items: "1-x"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := tt.options
+			err := validatePlaylistOptions(&options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validatePlaylistOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && options != tt.want {
+				t.Errorf("validatePlaylistOptions() = %+v, want %+v", options, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectPlaylistEntries(t *testing.T) {
+	entries := []ytdlwrapper.Entry{
+		{ID: "1", Title: "Episode 1", UploadDate: "20200101", Duration: 600},
+		{ID: "2", Title: "Episode 2 (live)", UploadDate: "20200201", Duration: 7200},
+		{ID: "3", Title: "Trailer", UploadDate: "20200301", Duration: 60},
+		{ID: "4", Title: "Episode 3", Duration: 0},
+		{ID: "5", Title: "Episode 4", UploadDate: "20200501", Duration: 900},
+	}
+
+	tests := []struct {
+		name    string
+		options creamqueue.PlaylistOptions
+		want    []string
+	}{
+		{"no options", creamqueue.PlaylistOptions{}, []string{"1", "2", "3", "4", "5"}},
+		{"items", creamqueue.PlaylistOptions{Items: "1,3-4"}, []string{"1", "3", "4"}},
+		{"open range", creamqueue.PlaylistOptions{Items: "4-"}, []string{"4", "5"}},
+		{"last", creamqueue.PlaylistOptions{Last: 2}, []string{"4", "5"}},
+		{"last more than there are", creamqueue.PlaylistOptions{Last: 10}, []string{"1", "2", "3", "4", "5"}},
+		{"reverse", creamqueue.PlaylistOptions{Reverse: true}, []string{"5", "4", "3", "2", "1"}},
+		{"dates keep unknown", creamqueue.PlaylistOptions{DateAfter: "20200201", DateBefore: "20200301"}, []string{"2", "3", "4"}},
+		{"title include", creamqueue.PlaylistOptions{TitleInclude: "^Episode"}, []string{"1", "2", "4", "5"}},
+		{"title exclude", creamqueue.PlaylistOptions{TitleExclude: "(?i)live|trailer"}, []string{"1", "4", "5"}},
+		{"durations keep unknown", creamqueue.PlaylistOptions{MinDuration: 120, MaxDuration: 3600}, []string{"1", "4", "5"}},
+		{"max", creamqueue.PlaylistOptions{Max: 2}, []string{"1", "2"}},
+		{"max after reverse", creamqueue.PlaylistOptions{Reverse: true, Max: 2}, []string{"5", "4"}},
+		{"max after filters", creamqueue.PlaylistOptions{TitleExclude: "live", Max: 2}, []string{"1", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := selectPlaylistEntries(entries, &tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, entry := range selected {
+				got = append(got, entry.ID)
+				// positions are kept for the children, even after filtering
+				if strconv.Itoa(entry.PlaylistIndex) != entry.ID {
+					t.Errorf("entry %v has position %v", entry.ID, entry.PlaylistIndex)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectPlaylistEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_selectPlaylistEntries_nested(t *testing.T) {
+	// a channel lists its tabs, titled after the channel
+	entries := []ytdlwrapper.Entry{
+		{Title: "Someone - Videos", RawURL: "https://www.youtube.com/@someone/videos", IEKey: "YoutubeTab"},
+		{Title: "Someone - Shorts", RawURL: "https://www.youtube.com/@someone/shorts", IEKey: "YoutubeTab"},
+		{Title: "Someone live", RawURL: "abc", IEKey: "Youtube"},
+	}
+
+	selected, err := selectPlaylistEntries(entries, &creamqueue.PlaylistOptions{TitleInclude: "(?i)trailer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selected) != 2 || selected[0].Title != "Someone - Videos" || selected[1].Title != "Someone - Shorts" {
+		t.Errorf("selectPlaylistEntries() = %+v, want both tabs", selected)
+	}
+}
+
+func Test_playlistChildData_options(t *testing.T) {
+	parent := creamqueue.JobData{
+		URL: "https://www.youtube.com/@someone",
+		Playlist: creamqueue.PlaylistOptions{
+			Items:        "1-2",
+			Last:         5,
+			Reverse:      true,
+			DateAfter:    "20200101",
+			DateBefore:   "20201231",
+			TitleInclude: "(?i)trailer",
+			TitleExclude: "(?i)live",
+			MinDuration:  60,
+			MaxDuration:  600,
+			Max:          3,
+		},
+	}
+	playlist := &ytdlwrapper.Playlist{ID: "UC1", Extractor: "youtube:tab"}
+	entry := &ytdlwrapper.Entry{Title: "Someone - Videos", RawURL: "https://www.youtube.com/@someone/videos", IEKey: "YoutubeTab"}
+
+	child := playlistChildData("channel", &parent, playlist, entry)
+
+	// the filters carry over to the tab, positions and counts don't
+	want := creamqueue.PlaylistOptions{
+		DateAfter:    "20200101",
+		DateBefore:   "20201231",
+		TitleInclude: "(?i)trailer",
+		TitleExclude: "(?i)live",
+		MinDuration:  60,
+		MaxDuration:  600,
+	}
+	if child.Playlist != want {
+		t.Errorf("child playlist options = %+v, want %+v", child.Playlist, want)
+	}
+}
+
+func Test_checkPlaylistNesting(t *testing.T) {
+	channel := creamqueue.PlaylistRef{ID: "UC1", Extractor: "youtube:tab", URL: "https://www.youtube.com/@someone"}
+	videosTab := creamqueue.PlaylistRef{ID: "UC1", Extractor: "youtube:tab", URL: "https://www.youtube.com/@someone/videos"}
+	other := creamqueue.PlaylistRef{ID: "PL1", Extractor: "youtube:tab", URL: "https://www.youtube.com/playlist?list=PL1"}
+
+	tests := []struct {
+		name     string
+		ancestry []creamqueue.PlaylistRef
+		playlist creamqueue.PlaylistRef
+		maxDepth int
+		wantErr  bool
+	}{
+		{"submitted playlist", nil, channel, 0, false},
+		{"channel tab", []creamqueue.PlaylistRef{channel}, videosTab, 1, false},
+		{"too deep", []creamqueue.PlaylistRef{channel}, videosTab, 0, true},
+		{"deeper still", []creamqueue.PlaylistRef{channel, videosTab}, other, 1, true},
+		{"contains itself", []creamqueue.PlaylistRef{channel}, channel, 5, true},
+		{"cycle further up", []creamqueue.PlaylistRef{other, videosTab}, other, 5, true},
+		{"unknown url", []creamqueue.PlaylistRef{{ID: "PL1", Extractor: "youtube:tab"}}, other, 5, true},
+		{"same id elsewhere", []creamqueue.PlaylistRef{{ID: "PL1", Extractor: "vimeo:album"}}, other, 5, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkPlaylistNesting(tt.ancestry, tt.playlist, tt.maxDepth); (err != nil) != tt.wantErr {
+				t.Errorf("checkPlaylistNesting() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_importTags_playlist(t *testing.T) {
+	useTestTagging(t)
+
+	tests := []struct {
+		name    string
+		jobData creamqueue.JobData
+		want    []string
+	}{
+		{
+			name:    "not in a playlist",
+			jobData: creamqueue.JobData{},
+			want:    []string{"importer:cvi", "extractor:youtube", "youtube-id:abc"},
+		},
+		{
+			name:    "known extractor",
+			jobData: creamqueue.JobData{ParentPlaylistID: "PL1", ParentPlaylistExtractor: "youtube:playlist", PlaylistIndex: 12},
+			want:    []string{"importer:cvi", "extractor:youtube", "youtube-id:abc", "youtube-playlist:PL1", "youtube-playlist-index:12"},
+		},
+		{
+			name:    "unknown extractor",
+			jobData: creamqueue.JobData{ParentPlaylistID: "PL1", PlaylistIndex: 3},
+			want:    []string{"importer:cvi", "extractor:youtube", "youtube-id:abc", "imported-playlist:PL1", "imported-playlist-index:3"},
+		},
+		{
+			name:    "unknown position",
+			jobData: creamqueue.JobData{ParentPlaylistID: "PL1", ParentPlaylistExtractor: "youtube:playlist"},
+			want:    []string{"importer:cvi", "extractor:youtube", "youtube-id:abc", "youtube-playlist:PL1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := importTags(&tt.jobData, &ytdlwrapper.Entry{ID: "abc", Extractor: "youtube"}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("importTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
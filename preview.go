@@ -0,0 +1,355 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/directdownload"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+	"github.com/dustin/go-humanize"
+)
+
+// A videoPreview is what importing a single video would upload
+type videoPreview struct {
+	URL           string `json:"url"`
+	PlaylistIndex int    `json:"playlist_index,omitempty"`
+	// Partial is set for videos described from a playlist listing. Their own info
+	// is only fetched when they are imported, which can change their metadata.
+	Partial bool `json:"partial"`
+
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	Tags          []string `json:"tags"`
+	Rules         []string `json:"rules"`
+	FormatProfile string   `json:"format_profile"`
+
+	// Duration is in seconds and Size in bytes, both 0 if unknown
+	Duration float64              `json:"duration"`
+	Size     int64                `json:"size"`
+	Chapters int                  `json:"chapters"`
+	Formats  []ytdlwrapper.Format `json:"formats"`
+}
+
+// An importPreview describes what queueing a URL would do, without queueing it
+type importPreview struct {
+	URL        string `json:"url"`
+	Direct     bool   `json:"direct"`
+	IsPlaylist bool   `json:"is_playlist"`
+
+	PlaylistID    string `json:"playlist_id,omitempty"`
+	PlaylistTitle string `json:"playlist_title,omitempty"`
+	// TotalEntries counts every video found, Entries only the ones the playlist options picked
+	TotalEntries int            `json:"total_entries"`
+	Entries      []videoPreview `json:"entries"`
+
+	// Duration and Size add up the picked videos, leaving out the unknown ones
+	Duration         float64 `json:"duration"`
+	Size             int64   `json:"size"`
+	UnknownDurations int     `json:"unknown_durations"`
+	UnknownSizes     int     `json:"unknown_sizes"`
+}
+
+func (preview *importPreview) add(video videoPreview) {
+	preview.Entries = append(preview.Entries, video)
+
+	if video.Duration > 0 {
+		preview.Duration += video.Duration
+	} else {
+		preview.UnknownDurations++
+	}
+
+	if video.Size > 0 {
+		preview.Size += video.Size
+	} else {
+		preview.UnknownSizes++
+	}
+}
+
+// previewVideo renders the metadata of the video the same way processJob would
+func previewVideo(jobData *creamqueue.JobData, entry *ytdlwrapper.Entry, importedAt time.Time) (videoPreview, error) {
+	plan := planImport(jobData, entry)
+	title, description, err := buildMetadata(jobData, entry, nil, importedAt)
+	if err != nil {
+		return videoPreview{}, err
+	}
+
+	formats := entry.Formats
+	if formats == nil {
+		formats = []ytdlwrapper.Format{}
+	}
+
+	return videoPreview{
+		URL:           entry.BestURL(),
+		PlaylistIndex: jobData.PlaylistIndex,
+
+		Title:         title,
+		Description:   description,
+		Tags:          plan.Tags,
+		Rules:         plan.Rules,
+		FormatProfile: plan.FormatProfileName,
+
+		Duration: entry.Duration,
+		Size:     entry.EstimatedSize(),
+		Chapters: len(entry.Chapters),
+		Formats:  formats,
+	}, nil
+}
+
+// previewInfo describes what the job would import from the fetched info.
+// The videos of a playlist are described from the playlist listing,
+// their own info is only fetched once they are imported.
+func previewInfo(jobData creamqueue.JobData, info *ytdlwrapper.InfoOutput, direct *directdownload.Info) (*importPreview, error) {
+	jobData.Tags = tagNormalizer.Tags(jobData.Tags)
+	importedAt := time.Now()
+
+	preview := &importPreview{
+		URL:        jobData.URL,
+		Direct:     direct != nil,
+		IsPlaylist: info.IsPlaylist,
+		Entries:    []videoPreview{},
+	}
+
+	if !info.IsPlaylist {
+		video, err := previewVideo(&jobData, &info.Entry, importedAt)
+		if err != nil {
+			return nil, err
+		}
+		preview.TotalEntries = 1
+		preview.add(video)
+		return preview, nil
+	}
+
+	if err := checkPlaylistNesting(jobData.PlaylistAncestry, playlistRef(&info.Playlist, jobData.URL), config.maxPlaylistDepth); err != nil {
+		return nil, err
+	}
+
+	entries, err := selectPlaylistEntries(info.Playlist.Entries, &jobData.Playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.PlaylistID = info.Playlist.ID
+	preview.PlaylistTitle = info.Playlist.Title
+	preview.TotalEntries = len(info.Playlist.Entries)
+	for i := range entries {
+		child := playlistChildData("", &jobData, &info.Playlist, &entries[i])
+		video, err := previewVideo(&child, &entries[i], importedAt)
+		if err != nil {
+			return nil, err
+		}
+		video.Partial = true
+		preview.add(video)
+	}
+
+	return preview, nil
+}
+
+// previewJob fetches the info of the job's URL and describes what importing it would do,
+// returning the status to answer with if it fails
+func previewJob(ctx context.Context, jobData creamqueue.JobData) (*importPreview, int, error) {
+	info, direct, err := fetchInfo(ctx, ytdlwrapper.Make(), directdownload.Make(), jobData.URL)
+	if err != nil {
+		return nil, 502, fmt.Errorf("failed fetching info: %w", err)
+	}
+
+	preview, err := previewInfo(jobData, info, direct)
+	if err != nil {
+		return nil, 422, err
+	}
+	return preview, 200, nil
+}
+
+func handlerAPIPreviewJob(w http.ResponseWriter, r *http.Request) {
+	request := apiCreateJobRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeJSONError(w, 400, "bad data")
+		return
+	}
+
+	if request.URL == "" {
+		writeJSONError(w, 422, "missing \"url\" value")
+		return
+	}
+
+	data, err := request.jobData(r)
+	if err != nil {
+		writeJSONError(w, 422, err.Error())
+		return
+	}
+
+	preview, status, err := previewJob(r.Context(), data)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, status, preview)
+}
+
+var templatePreview = template.Must(template.New("preview").Funcs(template.FuncMap{
+	"humanSize": func(size int64) string {
+		if size <= 0 {
+			return "unknown size"
+		}
+		return humanize.Bytes(uint64(size))
+	},
+	"humanDuration": func(seconds float64) string {
+		if seconds <= 0 {
+			return "unknown duration"
+		}
+		return time.Duration(seconds * float64(time.Second)).Truncate(time.Second).String()
+	},
+}).Parse(`
+<!DOCTYPE html>
+<html lang="en">
+	<head>
+		<meta charset="utf-8">
+		<title>Creamy Videos Importer</title>
+		<meta name="viewport" content="width=device-width, initial-scale=1">
+		<style type="text/css">
+		html, body {
+			font-family: mono;
+			background-color: #1b1b1b;
+			color: #ababab;
+		}
+		a, a:visited {
+			color: mediumaquamarine;
+		}
+
+		.tag {
+			background-color: #ababab;
+			color: #1b1b1b;
+			font-size: smaller;
+			border-radius: 0.25em;
+			padding: 0.25em;
+		}
+		.video { border-top: 1px solid rgba(255,255,255,0.2); padding: 0.5em 0; }
+		.description { white-space: pre-wrap; }
+		.rules, .partial { opacity: 0.7; }
+		</style>
+	</head>
+	<body>
+		<p><a href="/">Back to jobs</a></p>
+
+		<form method="POST" action="/">
+			{{ range $name, $values := .Form }}
+				{{ range $values }}
+					<input type="hidden" name="{{ $name }}" value="{{ . }}">
+				{{ end }}
+			{{ end }}
+			<button type="submit">Queue it</button>
+		</form>
+
+		{{ with .Preview }}
+			<h2>
+				{{ if .IsPlaylist }}
+					Playlist {{ if .PlaylistTitle }}{{ .PlaylistTitle }}{{ else }}{{ .PlaylistID }}{{ end }}:
+					{{ len .Entries }} of {{ .TotalEntries }} videos picked
+				{{ else if .Direct }}
+					Media file
+				{{ else }}
+					Video
+				{{ end }}
+			</h2>
+			{{ if .IsPlaylist }}
+				<p class="partial">
+					Videos are described from the playlist listing. Their title, description, tags and rules
+					can change once their own info is fetched while importing them.
+				</p>
+			{{ end }}
+			<p>
+				{{ humanDuration .Duration }}{{ if (and .Duration .UnknownDurations) }} ({{ .UnknownDurations }} unknown){{ end }},
+				{{ humanSize .Size }}{{ if (and .Size .UnknownSizes) }} ({{ .UnknownSizes }} unknown){{ end }}
+			</p>
+
+			{{ range .Entries }}
+				<div class="video">
+					<strong>{{ if .PlaylistIndex }}#{{ .PlaylistIndex }} {{ end }}{{ .Title }}</strong>
+					{{ if .Partial }}<span class="partial">(partial)</span>{{ end }}
+					(<a href="{{ .URL }}">{{ .URL }}</a>)
+					<br>
+					{{ humanDuration .Duration }}, {{ humanSize .Size }}, format profile {{ .FormatProfile }}{{ if .Chapters }}, {{ .Chapters }} chapters{{ end }}
+
+					{{ if .Description }}
+						<p class="description">{{ .Description }}</p>
+					{{ end }}
+
+					<p>
+						{{ range .Tags }}
+							<span class="tag">{{ . }}</span>
+						{{ end }}
+					</p>
+
+					{{ if .Rules }}
+						<p class="rules">Rules: {{ range $i, $rule := .Rules }}{{ if $i }}, {{ end }}{{ $rule }}{{ end }}</p>
+					{{ end }}
+
+					{{ if .Formats }}
+						<details>
+							<summary>{{ len .Formats }} formats</summary>
+							<ul>
+								{{ range .Formats }}
+									<li>
+										{{ .FormatID }}: {{ .Ext }}
+										{{ if .Height }}{{ .Width }}x{{ .Height }}{{ end }}
+										{{ .FormatNote }}
+										{{ if (and .VCodec (ne .VCodec "none")) }}video {{ .VCodec }}{{ end }}
+										{{ if (and .ACodec (ne .ACodec "none")) }}audio {{ .ACodec }}{{ end }}
+										{{ if .Size }}({{ humanSize .Size }}){{ end }}
+									</li>
+								{{ end }}
+							</ul>
+						</details>
+					{{ end }}
+				</div>
+			{{ end }}
+		{{ end }}
+	</body>
+</html>
+`))
+
+func handlerPreviewJob(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte("bad data"))
+		return
+	}
+
+	url := r.FormValue("url")
+	if url == "" {
+		w.WriteHeader(422)
+		w.Write([]byte("missing \"url\" value"))
+		return
+	}
+
+	data, err := jobDataFromForm(r)
+	if err != nil {
+		w.WriteHeader(422)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	data.URL = url
+
+	preview, status, err := previewJob(r.Context(), data)
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	w.Header().Add("Content-Type", "text/html")
+	err = templatePreview.Execute(w, struct {
+		Preview *importPreview
+		// Form is submitted again as is when the job gets queued
+		Form map[string][]string
+	}{preview, r.PostForm})
+	if err != nil {
+		log.Println("error rendering preview template:", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/directdownload"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+func Test_previewInfo_video(t *testing.T) {
+	useTestTagging(t)
+
+	info := &ytdlwrapper.InfoOutput{
+		Entry: ytdlwrapper.Entry{
+			ID:             "abc",
+			Title:          "Big Buck Bunny",
+			Extractor:      "youtube",
+			WebpageURL:     "https://www.youtube.com/watch?v=abc",
+			Duration:       596,
+			FilesizeApprox: 1000,
+			Formats:        []ytdlwrapper.Format{{FormatID: "18", Ext: "mp4", Height: 360}},
+		},
+	}
+	jobData := creamqueue.JobData{
+		URL:           "https://www.youtube.com/watch?v=abc",
+		Tags:          []string{"bunny"},
+		TitleTemplate: "{{ .Entry.Title }} ({{ .Entry.Extractor }})",
+	}
+
+	preview, err := previewInfo(jobData, info, nil)
+	if err != nil {
+		t.Fatalf("previewInfo() error = %v", err)
+	}
+	if preview.IsPlaylist || preview.Direct || preview.TotalEntries != 1 || len(preview.Entries) != 1 {
+		t.Fatalf("previewInfo() = %+v, want a single video", preview)
+	}
+
+	video := preview.Entries[0]
+	if video.Partial {
+		t.Error("single video preview is partial")
+	}
+	if video.Title != "Big Buck Bunny (youtube)" {
+		t.Errorf("title = %q", video.Title)
+	}
+	wantTags := []string{"bunny", "importer:cvi", "extractor:youtube", "youtube-id:abc"}
+	if !reflect.DeepEqual(video.Tags, wantTags) {
+		t.Errorf("tags = %v, want %v", video.Tags, wantTags)
+	}
+	if video.Size != 1000 || preview.Size != 1000 || preview.Duration != 596 {
+		t.Errorf("size = %v, total size = %v, total duration = %v", video.Size, preview.Size, preview.Duration)
+	}
+	if len(video.Formats) != 1 {
+		t.Errorf("formats = %v", video.Formats)
+	}
+}
+
+func Test_previewInfo_direct(t *testing.T) {
+	useTestTagging(t)
+
+	direct := &directdownload.Info{URL: "https://example.com/bunny.mp4", Size: 2048}
+	preview, err := previewInfo(creamqueue.JobData{URL: direct.URL}, &ytdlwrapper.InfoOutput{Entry: directEntry(direct)}, direct)
+	if err != nil {
+		t.Fatalf("previewInfo() error = %v", err)
+	}
+	if !preview.Direct || preview.Size != 2048 || preview.UnknownDurations != 1 {
+		t.Errorf("previewInfo() = %+v", preview)
+	}
+}
+
+func Test_previewInfo_playlist(t *testing.T) {
+	useTestTagging(t)
+	config.maxPlaylistDepth = 1
+
+	info := &ytdlwrapper.InfoOutput{
+		IsPlaylist: true,
+		Playlist: ytdlwrapper.Playlist{
+			ID:        "PL1",
+			Title:     "Shorts",
+			Extractor: "youtube:playlist",
+			Entries: []ytdlwrapper.Entry{
+				{ID: "a", Title: "One", RawURL: "a", IEKey: "Youtube", Duration: 60},
+				{ID: "b", Title: "Two", RawURL: "b", IEKey: "Youtube"},
+				{ID: "c", Title: "Three", RawURL: "c", IEKey: "Youtube", Duration: 30},
+			},
+		},
+	}
+	jobData := creamqueue.JobData{
+		URL:      "https://www.youtube.com/playlist?list=PL1",
+		Tags:     []string{},
+		Playlist: creamqueue.PlaylistOptions{Items: "2-3"},
+	}
+
+	preview, err := previewInfo(jobData, info, nil)
+	if err != nil {
+		t.Fatalf("previewInfo() error = %v", err)
+	}
+	if !preview.IsPlaylist || preview.PlaylistTitle != "Shorts" || preview.TotalEntries != 3 || len(preview.Entries) != 2 {
+		t.Fatalf("previewInfo() = %+v, want 2 of 3 videos of the playlist", preview)
+	}
+	if preview.Duration != 30 || preview.UnknownDurations != 1 || preview.UnknownSizes != 2 {
+		t.Errorf("duration = %v, unknown durations = %v, unknown sizes = %v", preview.Duration, preview.UnknownDurations, preview.UnknownSizes)
+	}
+
+	video := preview.Entries[0]
+	if video.URL != "https://www.youtube.com/watch?v=b" || video.PlaylistIndex != 2 || !video.Partial {
+		t.Errorf("first video = %+v", video)
+	}
+	wantTags := []string{"importer:cvi", "youtube-playlist:PL1", "youtube-playlist-index:2"}
+	if !reflect.DeepEqual(video.Tags, wantTags) {
+		t.Errorf("tags = %v, want %v", video.Tags, wantTags)
+	}
+
+	var out bytes.Buffer
+	if err := templatePreview.Execute(&out, struct {
+		Preview *importPreview
+		Form    map[string][]string
+	}{preview, map[string][]string{"url": {jobData.URL}, "playlist_items": {"2-3"}}}); err != nil {
+		t.Errorf("rendering preview: %v", err)
+	}
+}
+
+func Test_previewInfo_nested(t *testing.T) {
+	useTestTagging(t)
+	config.maxPlaylistDepth = 1
+
+	info := &ytdlwrapper.InfoOutput{
+		IsPlaylist: true,
+		Playlist:   ytdlwrapper.Playlist{ID: "PL1", Extractor: "youtube:tab"},
+	}
+	jobData := creamqueue.JobData{
+		URL:              "https://www.youtube.com/playlist?list=PL1",
+		PlaylistAncestry: []creamqueue.PlaylistRef{{ID: "PL1", Extractor: "youtube:tab"}},
+	}
+
+	if _, err := previewInfo(jobData, info, nil); err == nil {
+		t.Error("previewInfo() error = nil, want the playlist cycle to be refused")
+	}
+}
@@ -3,12 +3,114 @@ package main
 import (
 	"context"
 	"log"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
 )
 
+// validateJobOptions checks the options of a job before it is queued
+func validateJobOptions(data *creamqueue.JobData) error {
+	if data.FormatProfile != "" {
+		if err := validateFormatProfile(data.FormatProfile); err != nil {
+			return err
+		}
+	}
+
+	if data.RecodeProfile != "" {
+		if err := validateRecodeProfile(data.RecodeProfile); err != nil {
+			return err
+		}
+	}
+
+	if err := validatePlaylistOptions(&data.Playlist); err != nil {
+		return err
+	}
+
+	return validateMetadataTemplates(data)
+}
+
+// queueJob normalizes the job's tags, pushes it to the queue and returns its ID
+func queueJob(data creamqueue.JobData) creamqueue.JobID {
+	data.Tags = tagNormalizer.Tags(data.Tags)
+	id := idGenerator.Next()
+	queue.Push(id, data)
+	return id
+}
+
+// updateWaitingJob changes a job that has not been started yet,
+// returning false if the job is no longer waiting
+func updateWaitingJob(id creamqueue.JobID, updater func(data *creamqueue.JobData)) bool {
+	data, ok := queue.UpdateWaiting(id, updater)
+	if !ok {
+		return false
+	}
+
+	jobRepo.Update(id, func(job *jobInformation) {
+		job.Data = data
+	})
+	return true
+}
+
+// cancelledHandlers are called once a waiting job was cancelled
+var cancelledHandlers []func(id creamqueue.JobID, data creamqueue.JobData)
+
+// onCancelled adds a handler called once a waiting job was cancelled,
+// it must be added before jobs can be cancelled
+func onCancelled(handler func(id creamqueue.JobID, data creamqueue.JobData)) {
+	cancelledHandlers = append(cancelledHandlers, handler)
+}
+
+// cancelWaitingJob stops a job that has not been started yet,
+// returning false if the job is no longer waiting
+func cancelWaitingJob(id creamqueue.JobID) bool {
+	data, ok := queue.RemoveWaiting(id)
+	if !ok {
+		return false
+	}
+
+	log.Println("cancelled", id, data.URL)
+	jobRepo.Update(id, func(job *jobInformation) {
+		job.StoppedAt = time.Now()
+		job.Status = "cancelled"
+		job.Data = data
+	})
+	removeStagedUpload(data)
+	// the job might have been waiting for another attempt
+	removePartialDownloads(id)
+	for _, handler := range cancelledHandlers {
+		handler(id, data)
+	}
+	jobRepo.Settle(id)
+	if data.ParentJobID != "" {
+		releaseChildren(data.ParentJobID)
+	}
+	return true
+}
+
+// retryJob queues a failed job again under the same ID,
+// returning false if it is no longer failed or the file of a local job is gone
+func retryJob(id creamqueue.JobID) bool {
+	// the job is stored again once it is queued
+	data, ok := jobRepo.TakeFailed(id, func(data creamqueue.JobData) bool {
+		if data.LocalPath == "" {
+			return true
+		}
+		if _, err := os.Stat(data.LocalPath); err != nil {
+			log.Println("not retrying", id, err)
+			return false
+		}
+		return true
+	})
+	if !ok {
+		return false
+	}
+
+	queue.Push(id, data)
+	return true
+}
+
 func bootQueue(ctx context.Context) chan bool {
 	queue.OnFinished(func(id creamqueue.JobID, data creamqueue.JobData, result creamqueue.JobResult) {
 		log.Println("finished", id, data.URL, result.Title, result.CreamyURL)
@@ -18,6 +120,11 @@ func bootQueue(ctx context.Context) chan bool {
 			job.Data = data
 			job.Result = result
 		})
+		removeStagedUpload(data)
+		jobRepo.Settle(id)
+		if data.ParentJobID != "" {
+			releaseChildren(data.ParentJobID)
+		}
 	})
 
 	queue.OnFailed(func(id creamqueue.JobID, data creamqueue.JobData, failures []creamqueue.JobFailure) {
@@ -28,6 +135,12 @@ func bootQueue(ctx context.Context) chan bool {
 			job.Data = data
 			job.Failures = failures
 		})
+		removePartialDownloads(id)
+		// the upload is kept so the job can be retried, it goes once the job leaves the history
+		jobRepo.Settle(id)
+		if data.ParentJobID != "" {
+			releaseChildren(data.ParentJobID)
+		}
 	})
 
 	queue.OnStarted(func(id creamqueue.JobID, data creamqueue.JobData) {
@@ -52,7 +165,33 @@ func bootQueue(ctx context.Context) chan bool {
 			job.CreatedAt = time.Now()
 			job.Status = "waiting"
 			job.Data = data
+			job.ParentID = data.ParentJobID
 		})
+		if data.ParentJobID != "" {
+			jobRepo.AddChild(data.ParentJobID, id)
+		}
+	})
+
+	queue.OnScheduled(func(id creamqueue.JobID, data creamqueue.JobData, until time.Time) {
+		log.Println("scheduled", id, data.URL, until)
+		jobRepo.Update(id, func(job *jobInformation) {
+			job.Status = "scheduled"
+			job.ScheduledUntil = until
+			job.Data = data
+		})
+	})
+
+	queue.OnReleased(func(id creamqueue.JobID, data creamqueue.JobData) {
+		log.Println("released", id, data.URL)
+		jobRepo.Update(id, func(job *jobInformation) {
+			job.Status = "waiting"
+			job.ScheduledUntil = time.Time{}
+			job.Data = data
+		})
+	})
+
+	jobRepo.OnGroupCompleted(func(id creamqueue.JobID, data creamqueue.JobData, counts groupCounts) {
+		log.Println("group completed", id, data.URL, counts.Finished, "finished", counts.Failed, "failed")
 	})
 
 	workerWaitGroup := sync.WaitGroup{}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+)
+
+// noRecodeProfileName is the built-in profile that uploads downloads as-is
+const noRecodeProfileName = "none"
+
+const (
+	recodeModeRemux     = "remux"
+	recodeModeTranscode = "transcode"
+)
+
+// A recodeProfile describes what ffmpeg does between download and upload
+type recodeProfile struct {
+	// Mode is "remux" to copy the streams into an mp4 container,
+	// "transcode" to re-encode them as H.264/AAC, or empty to do nothing
+	Mode string `json:"mode"`
+
+	// CRF is the x264 quality, lower is better. Defaults to 23.
+	CRF int `json:"crf"`
+	// Preset is the x264 preset, defaults to "veryfast"
+	Preset string `json:"preset"`
+	// MaxHeight scales taller videos down, keeping their aspect ratio
+	MaxHeight int `json:"max_height"`
+	// AudioBitrate defaults to "128k"
+	AudioBitrate string `json:"audio_bitrate"`
+	// SkipCompatible uploads files that already are H.264/AAC mp4 within MaxHeight as-is
+	SkipCompatible bool `json:"skip_compatible"`
+}
+
+var builtinRecodeProfiles = map[string]recodeProfile{
+	noRecodeProfileName: {},
+	"remux-mp4": {
+		Mode: recodeModeRemux,
+	},
+	"h264-1080p": {
+		Mode:           recodeModeTranscode,
+		MaxHeight:      1080,
+		SkipCompatible: true,
+	},
+}
+
+func (profile *recodeProfile) validate() error {
+	switch profile.Mode {
+	case "", recodeModeRemux, recodeModeTranscode:
+	default:
+		return fmt.Errorf("unknown mode %q, expected %q or %q", profile.Mode, recodeModeRemux, recodeModeTranscode)
+	}
+	if profile.CRF < 0 || profile.CRF > 51 {
+		return fmt.Errorf("crf %v out of range 0-51", profile.CRF)
+	}
+	if profile.MaxHeight < 0 {
+		return fmt.Errorf("max_height %v can't be negative", profile.MaxHeight)
+	}
+	return nil
+}
+
+// needed reports whether the probed file has to go through ffmpeg
+func (profile *recodeProfile) needed(path string, probed *ffmpegwrapper.ProbeOutput) bool {
+	isMP4 := strings.EqualFold(filepath.Ext(path), ".mp4") && strings.Contains(probed.FormatName, "mp4")
+
+	switch profile.Mode {
+	case recodeModeRemux:
+		return !isMP4
+	case recodeModeTranscode:
+		if !profile.SkipCompatible {
+			return true
+		}
+		compatible := isMP4 &&
+			probed.VideoCodec == "h264" &&
+			(probed.AudioCodec == "aac" || probed.AudioCodec == "") &&
+			(profile.MaxHeight == 0 || probed.Height <= profile.MaxHeight)
+		return !compatible
+	}
+	return false
+}
+
+// args returns the ffmpeg arguments turning input into the mp4 output
+func (profile *recodeProfile) args(input, output string) []string {
+	args := []string{"-i", input, "-map", "0:v:0?", "-map", "0:a:0?"}
+
+	if profile.Mode == recodeModeRemux {
+		args = append(args, "-c", "copy")
+	} else {
+		crf := profile.CRF
+		if crf == 0 {
+			crf = 23
+		}
+		preset := profile.Preset
+		if preset == "" {
+			preset = "veryfast"
+		}
+		audioBitrate := profile.AudioBitrate
+		if audioBitrate == "" {
+			audioBitrate = "128k"
+		}
+
+		args = append(args, "-c:v", "libx264", "-preset", preset, "-crf", strconv.Itoa(crf), "-pix_fmt", "yuv420p")
+		if profile.MaxHeight > 0 {
+			// -2 keeps the width even, which libx264 needs
+			args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%v,ih)'", profile.MaxHeight))
+		}
+		args = append(args, "-c:a", "aac", "-b:a", audioBitrate)
+	}
+
+	return append(args, "-movflags", "+faststart", "-f", "mp4", output)
+}
+
+func validateRecodeProfile(name string) error {
+	if _, ok := recodeProfiles[name]; !ok {
+		return fmt.Errorf("unknown recode profile %q", name)
+	}
+	return nil
+}
+
+// recodeProfileNames returns the names of every profile, sorted
+func recodeProfileNames() []string {
+	names := make([]string, 0, len(recodeProfiles))
+	for name := range recodeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pickRecodeProfile returns the profile asked for by the job, or the default one
+func pickRecodeProfile(jobProfile string) (string, recodeProfile) {
+	name := config.defaultRecodeProfile
+	if jobProfile != "" {
+		name = jobProfile
+	}
+	return name, recodeProfiles[name]
+}
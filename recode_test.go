@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+)
+
+func Test_recodeProfile_needed(t *testing.T) {
+	compatible := &ffmpegwrapper.ProbeOutput{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", VideoCodec: "h264", AudioCodec: "aac", Height: 720}
+	webm := &ffmpegwrapper.ProbeOutput{FormatName: "matroska,webm", VideoCodec: "vp9", AudioCodec: "opus", Height: 720}
+	tall := &ffmpegwrapper.ProbeOutput{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", VideoCodec: "h264", AudioCodec: "aac", Height: 2160}
+
+	tests := []struct {
+		name    string
+		profile recodeProfile
+		path    string
+		probed  *ffmpegwrapper.ProbeOutput
+		want    bool
+	}{
+		{"none", recodeProfile{}, "1.webm", webm, false},
+		{"remux mp4", recodeProfile{Mode: recodeModeRemux}, "1.mp4", compatible, false},
+		{"remux webm", recodeProfile{Mode: recodeModeRemux}, "1.webm", webm, true},
+		{"transcode always", recodeProfile{Mode: recodeModeTranscode}, "1.mp4", compatible, true},
+		{"transcode skips compatible", recodeProfile{Mode: recodeModeTranscode, SkipCompatible: true, MaxHeight: 1080}, "1.mp4", compatible, false},
+		{"transcode too tall", recodeProfile{Mode: recodeModeTranscode, SkipCompatible: true, MaxHeight: 1080}, "1.mp4", tall, true},
+		{"transcode webm", recodeProfile{Mode: recodeModeTranscode, SkipCompatible: true}, "1.webm", webm, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile.needed(tt.path, tt.probed); got != tt.want {
+				t.Errorf("needed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_recodeProfile_args(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile recodeProfile
+		want    []string
+	}{
+		{
+			name:    "remux",
+			profile: recodeProfile{Mode: recodeModeRemux},
+			want:    []string{"-i", "in.webm", "-map", "0:v:0?", "-map", "0:a:0?", "-c", "copy", "-movflags", "+faststart", "-f", "mp4", "out.mp4"},
+		},
+		{
+			name:    "transcode",
+			profile: recodeProfile{Mode: recodeModeTranscode, CRF: 20, MaxHeight: 720},
+			want: []string{
+				"-i", "in.webm", "-map", "0:v:0?", "-map", "0:a:0?",
+				"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p",
+				"-vf", "scale=-2:'min(720,ih)'",
+				"-c:a", "aac", "-b:a", "128k",
+				"-movflags", "+faststart", "-f", "mp4", "out.mp4",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.profile.args("in.webm", "out.mp4"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,16 +19,30 @@ type jobInformation struct {
 	StartedAt time.Time
 	StoppedAt time.Time
 
+	// ScheduledUntil is when a scheduled job will be considered again
+	ScheduledUntil time.Time
+
 	Progress creamqueue.JobProgress
 	Data     creamqueue.JobData
 	Failures []creamqueue.JobFailure
 	Result   creamqueue.JobResult
+
+	// ParentID is the playlist job that queued this job, if any
+	ParentID creamqueue.JobID
+	// Children are the jobs this playlist job queued
+	Children []creamqueue.JobID
+	// PendingChildren are the jobs this playlist job will queue once earlier children stop
+	PendingChildren []creamqueue.JobData
+	// GroupCompletedAt is when every child stopped
+	GroupCompletedAt time.Time
 }
 
 type jobRepository struct {
 	lock sync.RWMutex
 
 	jobs map[creamqueue.JobID]*jobInformation
+
+	groupCompletedHandlers []GroupCompletedHandler
 }
 
 func makeJobRepository() *jobRepository {
@@ -40,6 +55,7 @@ func (repo *jobRepository) Store(id creamqueue.JobID, updater func(job *jobInfor
 	job := &jobInformation{
 		ID:       id,
 		Failures: []creamqueue.JobFailure{},
+		Children: []creamqueue.JobID{},
 	}
 	updater(job)
 
@@ -71,25 +87,116 @@ func (repo *jobRepository) Update(id creamqueue.JobID, updater func(job *jobInfo
 	return nil
 }
 
+func (repo *jobRepository) View(id creamqueue.JobID, viewer func(job *jobInformation)) error {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	job, ok := repo.jobs[id]
+	if !ok {
+		return errors.New("Job ID not found: " + string(id))
+	}
+
+	job.lock.RLock()
+	defer job.lock.RUnlock()
+
+	viewer(job)
+
+	return nil
+}
+
 func (repo *jobRepository) Remove(id creamqueue.JobID) {
 	repo.lock.Lock()
 	defer repo.lock.Unlock()
 	delete(repo.jobs, id)
 }
 
+// TakeFailed removes a failed job so it can be queued again, returning its data.
+// It returns false if the job is no longer failed, or if retryable rejects it,
+// so only one retry can take each failure.
+func (repo *jobRepository) TakeFailed(id creamqueue.JobID, retryable func(data creamqueue.JobData) bool) (creamqueue.JobData, bool) {
+	// the write lock keeps every job lock free, so jobs can be read directly
+	repo.lock.Lock()
+	defer repo.lock.Unlock()
+
+	job, ok := repo.jobs[id]
+	if !ok || job.Status != "failed" || !retryable(job.Data) {
+		return creamqueue.JobData{}, false
+	}
+
+	delete(repo.jobs, id)
+	return job.Data, true
+}
+
+// RLockMatching read-locks and returns every job matching the filter, newest first.
+// The returned function releases the locks and must be called once done with the jobs.
+func (repo *jobRepository) RLockMatching(filter func(job *jobInformation) bool) ([]*jobInformation, func()) {
+	repo.lock.RLock()
+
+	jobs := []*jobInformation{}
+	for _, job := range repo.jobs {
+		job.lock.RLock()
+		if filter(job) {
+			jobs = append(jobs, job)
+		} else {
+			job.lock.RUnlock()
+		}
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+
+	return jobs, func() {
+		for _, job := range jobs {
+			job.lock.RUnlock()
+		}
+		repo.lock.RUnlock()
+	}
+}
+
+// ActiveURLs returns the URLs of every job that has not stopped yet
+func (repo *jobRepository) ActiveURLs() map[string]bool {
+	repo.lock.RLock()
+	defer repo.lock.RUnlock()
+
+	urls := map[string]bool{}
+	for _, job := range repo.jobs {
+		job.lock.RLock()
+		if job.StoppedAt.IsZero() {
+			urls[job.Data.URL] = true
+		}
+		job.lock.RUnlock()
+	}
+
+	return urls
+}
+
 func (repo *jobRepository) PurgeStopped(olderThan time.Duration) int {
 	ids := []creamqueue.JobID{}
+	purged := []creamqueue.JobData{}
 
 	repo.lock.RLock()
 	for id, job := range repo.jobs {
 		job.lock.RLock()
-		if job.StoppedAt.IsZero() {
+		if !job.settled() {
 			job.lock.RUnlock()
 			continue
 		}
 
-		if job.StoppedAt.Add(olderThan).Before(time.Now()) {
+		// children are kept until their whole group can go
+		if parent, ok := repo.jobs[job.ParentID]; ok && job.ParentID != "" && parent.GroupCompletedAt.IsZero() {
+			job.lock.RUnlock()
+			continue
+		}
+
+		stoppedAt := job.StoppedAt
+		if job.GroupCompletedAt.After(stoppedAt) {
+			stoppedAt = job.GroupCompletedAt
+		}
+
+		if stoppedAt.Add(olderThan).Before(time.Now()) {
 			ids = append(ids, id)
+			purged = append(purged, job.Data)
 		}
 		job.lock.RUnlock()
 	}
@@ -98,6 +205,10 @@ func (repo *jobRepository) PurgeStopped(olderThan time.Duration) int {
 	for _, id := range ids {
 		repo.Remove(id)
 	}
+	// failed uploads kept their file in case they were retried
+	for _, data := range purged {
+		removeStagedUpload(data)
+	}
 
 	return len(ids)
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/creamyvideos"
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+const (
+	subtitleModeUpload = "upload"
+	subtitleModeEmbed  = "embed"
+)
+
+// subtitleConfig is the "subtitles" section of the config file
+type subtitleConfig struct {
+	// Languages are downloaded for jobs that don't pick their own,
+	// none by default
+	Languages []string `json:"languages"`
+	// AutoCaptions also downloads automatically generated subtitles for every job
+	AutoCaptions bool `json:"auto_captions"`
+	// Mode is "upload" to send the subtitles alongside the video,
+	// or "embed" to add them to the video file itself
+	Mode string `json:"mode"`
+}
+
+func (subtitles *subtitleConfig) validate() error {
+	switch subtitles.Mode {
+	case subtitleModeUpload, subtitleModeEmbed:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q, expected %q or %q", subtitles.Mode, subtitleModeUpload, subtitleModeEmbed)
+}
+
+// parseSubtitleLanguages splits a comma-separated list like "en, de"
+func parseSubtitleLanguages(raw string) []string {
+	return cleanSubtitleLanguages(strings.Split(raw, ","))
+}
+
+// cleanSubtitleLanguages trims languages and drops empty ones
+func cleanSubtitleLanguages(raw []string) []string {
+	languages := []string{}
+	for _, language := range raw {
+		if language = strings.TrimSpace(language); language != "" {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+// pickSubtitleOptions returns what to download for the job,
+// and false if it doesn't want subtitles at all
+func pickSubtitleOptions(jobData *creamqueue.JobData) (ytdlwrapper.SubtitleOptions, bool) {
+	options := ytdlwrapper.SubtitleOptions{
+		Languages:    config.subtitles.Languages,
+		AutoCaptions: config.subtitles.AutoCaptions || jobData.AutoSubtitles,
+	}
+	if len(jobData.SubtitleLanguages) > 0 {
+		options.Languages = jobData.SubtitleLanguages
+	}
+	return options, len(options.Languages) > 0
+}
+
+func subtitlePrefix(id creamqueue.JobID) string {
+	return string(id) + ".subtitles"
+}
+
+func removeSubtitles(id creamqueue.JobID) {
+	matches, _ := filepath.Glob(subtitlePrefix(id) + ".*")
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+// findSubtitles returns the subtitles written by yt-dlp as WebVTT,
+// converting the ones yt-dlp couldn't
+func findSubtitles(ctx context.Context, id creamqueue.JobID) ([]ytdlwrapper.Subtitle, error) {
+	found, err := ytdlwrapper.FindSubtitles(subtitlePrefix(id))
+	if err != nil {
+		return nil, err
+	}
+
+	subtitles := []ytdlwrapper.Subtitle{}
+	for _, subtitle := range found {
+		if subtitle.Format == "vtt" {
+			subtitles = append(subtitles, subtitle)
+			continue
+		}
+		if hasSubtitleLanguage(found, subtitle.Language, "vtt") {
+			continue
+		}
+
+		converted := ytdlwrapper.Subtitle{
+			Language: subtitle.Language,
+			Format:   "vtt",
+			Path:     strings.TrimSuffix(subtitle.Path, subtitle.Format) + "vtt",
+		}
+		if err := ffmpegwrapper.Make().ConvertSubtitle(ctx, subtitle.Path, converted.Path); err != nil {
+			return nil, fmt.Errorf("failed converting %v subtitles: %w", subtitle.Language, err)
+		}
+		subtitles = append(subtitles, converted)
+	}
+
+	return subtitles, nil
+}
+
+func hasSubtitleLanguage(subtitles []ytdlwrapper.Subtitle, language, format string) bool {
+	for _, subtitle := range subtitles {
+		if subtitle.Language == language && subtitle.Format == format {
+			return true
+		}
+	}
+	return false
+}
+
+// subtitleAttachments returns the subtitles to upload alongside the video
+func subtitleAttachments(subtitles []ytdlwrapper.Subtitle) []creamyvideos.Attachment {
+	attachments := make([]creamyvideos.Attachment, len(subtitles))
+	for i, subtitle := range subtitles {
+		attachments[i] = creamyvideos.Attachment{
+			FieldName: creamyvideos.FieldSubtitles,
+			LocalPath: subtitle.Path,
+			FileName:  subtitle.Language + ".vtt",
+		}
+	}
+	return attachments
+}
+
+// embedSubtitleArgs returns the ffmpeg arguments copying the video and
+// adding the subtitles as extra streams
+func embedSubtitleArgs(video string, subtitles []ytdlwrapper.Subtitle, output string) []string {
+	args := []string{"-i", video}
+	for _, subtitle := range subtitles {
+		args = append(args, "-i", subtitle.Path)
+	}
+
+	args = append(args, "-map", "0:v?", "-map", "0:a?")
+	for i := range subtitles {
+		args = append(args, "-map", strconv.Itoa(i+1))
+	}
+
+	// mp4 only takes mov_text, webm and mkv take WebVTT as-is
+	subtitleCodec := "webvtt"
+	if strings.EqualFold(filepath.Ext(output), ".mp4") {
+		subtitleCodec = "mov_text"
+	}
+	args = append(args, "-c", "copy", "-c:s", subtitleCodec)
+
+	for i, subtitle := range subtitles {
+		stream := fmt.Sprintf("-metadata:s:s:%v", i)
+		args = append(args, stream, "language="+subtitle.Language, stream, "title="+subtitle.Language)
+	}
+
+	return append(args, output)
+}
+
+// embedSubtitles writes a copy of the video with the subtitles embedded,
+// returning the path of the copy
+func embedSubtitles(ctx context.Context, job creamqueue.QueuedJob, video string, subtitles []ytdlwrapper.Subtitle) (string, error) {
+	output := string(job.ID()) + ".subtitled" + filepath.Ext(video)
+	os.Remove(output)
+
+	job.Progress(creamqueue.JobProgress("Embedding subtitles"))
+	noProgress := func(*ffmpegwrapper.Progress) {}
+	if err := ffmpegwrapper.Make().RunWithProgress(ctx, noProgress, embedSubtitleArgs(video, subtitles, output)...); err != nil {
+		os.Remove(output)
+		return "", err
+	}
+	return output, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+func Test_embedSubtitleArgs(t *testing.T) {
+	subtitles := []ytdlwrapper.Subtitle{
+		{Language: "de", Format: "vtt", Path: "1.subtitles.de.vtt"},
+		{Language: "en", Format: "vtt", Path: "1.subtitles.en.vtt"},
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name:   "mp4",
+			output: "1.subtitled.mp4",
+			want: []string{
+				"-i", "1.mp4", "-i", "1.subtitles.de.vtt", "-i", "1.subtitles.en.vtt",
+				"-map", "0:v?", "-map", "0:a?", "-map", "1", "-map", "2",
+				"-c", "copy", "-c:s", "mov_text",
+				"-metadata:s:s:0", "language=de", "-metadata:s:s:0", "title=de",
+				"-metadata:s:s:1", "language=en", "-metadata:s:s:1", "title=en",
+				"1.subtitled.mp4",
+			},
+		},
+		{
+			name:   "webm",
+			output: "1.subtitled.webm",
+			want: []string{
+				"-i", "1.mp4", "-i", "1.subtitles.de.vtt", "-i", "1.subtitles.en.vtt",
+				"-map", "0:v?", "-map", "0:a?", "-map", "1", "-map", "2",
+				"-c", "copy", "-c:s", "webvtt",
+				"-metadata:s:s:0", "language=de", "-metadata:s:s:0", "title=de",
+				"-metadata:s:s:1", "language=en", "-metadata:s:s:1", "title=en",
+				"1.subtitled.webm",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := embedSubtitleArgs("1.mp4", subtitles, tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("embedSubtitleArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
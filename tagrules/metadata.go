@@ -0,0 +1,110 @@
+package tagrules
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+var hashtagExpression = regexp.MustCompile(`(?:^|[\s(\[])#([\p{L}\p{N}_]*[\p{L}_][\p{L}\p{N}_]*)`)
+
+// MetadataMapping decides which yt-dlp metadata is turned into tags.
+// Everything is off by default.
+type MetadataMapping struct {
+	// Tags and Categories copy the source tags and categories, categories as "category:<name>"
+	Tags       bool `json:"tags"`
+	Categories bool `json:"categories"`
+	// Hashtags extracts #hashtags from the description
+	Hashtags bool `json:"hashtags"`
+	// Uploader, Channel and Series add "uploader:<name>", "channel:<name>" and "series:<name>".
+	// Series also adds "season:<number>" and "episode:<number>".
+	Uploader bool `json:"uploader"`
+	Channel  bool `json:"channel"`
+	Series   bool `json:"series"`
+
+	// Prefix is prepended to every mapped tag
+	Prefix    string `json:"prefix"`
+	Lowercase bool   `json:"lowercase"`
+	// Allow, if set, and Deny are compared case-insensitively against the metadata value
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+	// MaxCount limits the amount of mapped tags, 0 is unlimited
+	MaxCount int `json:"max_count"`
+}
+
+// Hashtags returns the #hashtags found in the text, without the #
+func Hashtags(text string) []string {
+	hashtags := []string{}
+	for _, match := range hashtagExpression.FindAllStringSubmatch(text, -1) {
+		hashtags = append(hashtags, match[1])
+	}
+	return hashtags
+}
+
+func containsFold(list []string, value string) bool {
+	for _, candidate := range list {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Map returns the tags mapped from the entry's metadata
+func (mapping *MetadataMapping) Map(entry *ytdlwrapper.Entry) []string {
+	tags := []string{}
+	add := func(kind string, values ...string) {
+		for _, value := range values {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if len(mapping.Allow) > 0 && !containsFold(mapping.Allow, value) {
+				continue
+			}
+			if containsFold(mapping.Deny, value) {
+				continue
+			}
+			if mapping.MaxCount > 0 && len(tags) >= mapping.MaxCount {
+				return
+			}
+
+			tag := mapping.Prefix + kind + value
+			if mapping.Lowercase {
+				tag = strings.ToLower(tag)
+			}
+			if !hasTag(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	if mapping.Uploader {
+		add("uploader:", entry.Uploader)
+	}
+	if mapping.Channel {
+		add("channel:", entry.Channel)
+	}
+	if mapping.Series {
+		add("series:", entry.Series)
+		if entry.SeasonNumber > 0 {
+			add("season:", strconv.Itoa(entry.SeasonNumber))
+		}
+		if entry.EpisodeNumber > 0 {
+			add("episode:", strconv.Itoa(entry.EpisodeNumber))
+		}
+	}
+	if mapping.Categories {
+		add("category:", entry.Categories...)
+	}
+	if mapping.Tags {
+		add("", entry.Tags...)
+	}
+	if mapping.Hashtags {
+		add("", Hashtags(entry.Description)...)
+	}
+
+	return tags
+}
@@ -0,0 +1,86 @@
+package tagrules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+func TestHashtags(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"none", "nothing to see here", []string{}},
+		{"words", "#Food and #korean_bbq\n#먹방", []string{"Food", "korean_bbq", "먹방"}},
+		{"not hashtags", "issue #11, C#, https://example.com/#anchor, &#39;", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Hashtags(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Hashtags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataMapping_Map(t *testing.T) {
+	entry := &ytdlwrapper.Entry{
+		Uploader:      "Some Uploader",
+		Channel:       "Some Channel",
+		Series:        "Some Series",
+		SeasonNumber:  2,
+		EpisodeNumber: 5,
+		Tags:          []string{"K-Pop", "video", "Dance"},
+		Categories:    []string{"Music"},
+		Description:   "#Live #dance",
+	}
+
+	tests := []struct {
+		name    string
+		mapping MetadataMapping
+		want    []string
+	}{
+		{
+			name:    "off by default",
+			mapping: MetadataMapping{},
+			want:    []string{},
+		},
+		{
+			name: "everything",
+			mapping: MetadataMapping{
+				Tags: true, Categories: true, Hashtags: true,
+				Uploader: true, Channel: true, Series: true,
+			},
+			want: []string{"uploader:Some Uploader", "channel:Some Channel", "series:Some Series", "season:2", "episode:5", "category:Music", "K-Pop", "video", "Dance", "Live", "dance"},
+		},
+		{
+			name: "lowercase prefix deny and max count",
+			mapping: MetadataMapping{
+				Tags: true, Hashtags: true,
+				Prefix:    "yt:",
+				Lowercase: true,
+				Deny:      []string{"VIDEO"},
+				MaxCount:  3,
+			},
+			want: []string{"yt:k-pop", "yt:dance", "yt:live"},
+		},
+		{
+			name: "allow",
+			mapping: MetadataMapping{
+				Tags: true, Categories: true,
+				Allow: []string{"music", "k-pop"},
+			},
+			want: []string{"category:Music", "K-Pop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.Map(entry); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Map() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
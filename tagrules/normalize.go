@@ -0,0 +1,93 @@
+package tagrules
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalization configures how tags are cleaned up
+type Normalization struct {
+	// CaseSensitive keeps the case of tags, by default they are lowercased
+	CaseSensitive bool `json:"case_sensitive"`
+	// Aliases replace whole tags, or the part after the last colon,
+	// like {"kpop": "k-pop"} turning "music:KPop" into "music:k-pop"
+	Aliases map[string]string `json:"aliases"`
+}
+
+// A Normalizer cleans up tags: trimming, removing characters that can't be
+// part of a tag, case folding, replacing aliases and removing duplicates
+type Normalizer struct {
+	caseSensitive bool
+	aliases       map[string]string
+}
+
+// MakeNormalizer prepares the normalization for use
+func MakeNormalizer(normalization Normalization) *Normalizer {
+	normalizer := &Normalizer{
+		caseSensitive: normalization.CaseSensitive,
+		aliases:       map[string]string{},
+	}
+
+	for from, to := range normalization.Aliases {
+		normalizer.aliases[normalizer.clean(from)] = normalizer.clean(to)
+	}
+
+	return normalizer
+}
+
+// clean trims the tag, removes commas (they separate tags when uploading)
+// and control characters, collapses whitespace and folds case
+func (normalizer *Normalizer) clean(tag string) string {
+	tag = strings.Map(func(r rune) rune {
+		if r == ',' || unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, tag)
+
+	tag = strings.Join(strings.Fields(tag), " ")
+	tag = strings.TrimLeft(tag, "#")
+
+	if !normalizer.caseSensitive {
+		tag = strings.ToLower(tag)
+	}
+
+	return tag
+}
+
+// Tag normalizes a single tag. An empty string means the tag should be dropped.
+func (normalizer *Normalizer) Tag(tag string) string {
+	tag = normalizer.clean(tag)
+
+	if alias, ok := normalizer.aliases[tag]; ok {
+		return alias
+	}
+
+	if separator := strings.LastIndex(tag, ":"); separator != -1 {
+		if alias, ok := normalizer.aliases[tag[separator+1:]]; ok {
+			return tag[:separator+1] + alias
+		}
+	}
+
+	return tag
+}
+
+// Tags normalizes every tag, dropping empty ones and duplicates
+func (normalizer *Normalizer) Tags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized = append(normalized, normalizer.Tag(tag))
+	}
+	return Dedupe(normalized)
+}
+
+// Dedupe removes empty and repeated tags, keeping the first occurrence
+func Dedupe(tags []string) []string {
+	deduped := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag != "" && !hasTag(deduped, tag) {
+			deduped = append(deduped, tag)
+		}
+	}
+	return deduped
+}
@@ -0,0 +1,66 @@
+package tagrules
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizer_Tags(t *testing.T) {
+	aliases := map[string]string{
+		"kpop":   "k-pop",
+		" K-POP": "k-pop",
+		"Food":   "food",
+		"bbq":    "Barbecue",
+	}
+
+	tests := []struct {
+		name          string
+		normalization Normalization
+		tags          []string
+		want          []string
+	}{
+		{
+			name:          "trimming",
+			normalization: Normalization{},
+			tags:          []string{"food", " korean", "  korean bbq  ", ""},
+			want:          []string{"food", "korean", "korean bbq"},
+		},
+		{
+			name:          "case folding and dedupe",
+			normalization: Normalization{},
+			tags:          []string{"K-Pop", "k-pop", "music:K-POP", "Music:k-pop"},
+			want:          []string{"k-pop", "music:k-pop"},
+		},
+		{
+			name:          "case sensitive",
+			normalization: Normalization{CaseSensitive: true},
+			tags:          []string{"K-Pop", "k-pop"},
+			want:          []string{"K-Pop", "k-pop"},
+		},
+		{
+			name:          "sanitization",
+			normalization: Normalization{},
+			tags:          []string{"#hashtag", "two\twords", "line\nbreak", "a,b", "   "},
+			want:          []string{"hashtag", "two words", "line break", "a b"},
+		},
+		{
+			name:          "aliases",
+			normalization: Normalization{Aliases: aliases},
+			tags:          []string{"KPop", "k-pop", "music:kpop", "music:K-Pop", "FOOD", "food:bbq"},
+			want:          []string{"k-pop", "music:k-pop", "food", "food:barbecue"},
+		},
+		{
+			name:          "case sensitive aliases",
+			normalization: Normalization{CaseSensitive: true, Aliases: aliases},
+			tags:          []string{"kpop", "KPop", "Food", "food:bbq"},
+			want:          []string{"k-pop", "KPop", "food", "food:Barbecue"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MakeNormalizer(tt.normalization).Tags(tt.tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
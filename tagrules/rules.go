@@ -0,0 +1,210 @@
+package tagrules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+// Match decides which videos a Rule applies to.
+// Every field that is set has to match, an empty Match matches everything.
+type Match struct {
+	// Extractor is compared case-insensitively, like "youtube"
+	Extractor string `json:"extractor"`
+	ChannelID string `json:"channel_id"`
+	// Uploader is compared against the uploader ID
+	Uploader string `json:"uploader"`
+	// Title is a regular expression
+	Title string `json:"title"`
+	// MinDuration and MaxDuration are in seconds, videos of unknown duration never match them
+	MinDuration float64 `json:"min_duration"`
+	MaxDuration float64 `json:"max_duration"`
+	// HasTags requires all of these tags to already be on the video
+	HasTags []string `json:"has_tags"`
+	// SourceTags requires all of these tags to be in the source's own metadata,
+	// compared case-insensitively
+	SourceTags []string `json:"source_tags"`
+}
+
+// A Rule changes the tags of every video it matches
+type Rule struct {
+	Name  string `json:"name"`
+	Match Match  `json:"match"`
+
+	// Rename is applied first, then Remove, then Add
+	Rename map[string]string `json:"rename"`
+	Remove []string          `json:"remove"`
+	Add    []string          `json:"add"`
+
+	// FormatProfile picks the named format profile for matching videos,
+	// unless the job asked for one. The last matching rule wins.
+	FormatProfile string `json:"format_profile"`
+}
+
+// A Result is the outcome of applying rules to a video
+type Result struct {
+	Tags []string
+	// Applied are the names of the rules that matched
+	Applied       []string
+	FormatProfile string
+}
+
+type compiledRule struct {
+	Rule
+	title      *regexp.Regexp
+	normalizer *Normalizer
+}
+
+// An Engine applies rules in the order they were configured
+type Engine struct {
+	rules []compiledRule
+}
+
+// Make an Engine, validating the rules. The tags in the rules are normalized
+// with the given normalizer so they line up with normalized tags. Tags added
+// by the importer, like IDs, are kept as they are, so they are compared in
+// their normalized form.
+func Make(rules []Rule, normalizer *Normalizer) (*Engine, error) {
+	engine := &Engine{
+		rules: make([]compiledRule, len(rules)),
+	}
+
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		rule.Match.HasTags = normalizer.Tags(rule.Match.HasTags)
+		rule.Remove = normalizer.Tags(rule.Remove)
+		rule.Add = normalizer.Tags(rule.Add)
+		rename := map[string]string{}
+		for from, to := range rule.Rename {
+			rename[normalizer.Tag(from)] = normalizer.Tag(to)
+		}
+		rule.Rename = rename
+
+		compiled := compiledRule{Rule: rule, normalizer: normalizer}
+		if rule.Match.Title != "" {
+			title, err := regexp.Compile(rule.Match.Title)
+			if err != nil {
+				return nil, fmt.Errorf("%v: invalid title expression: %w", rule.Name, err)
+			}
+			compiled.title = title
+		}
+
+		engine.rules[i] = compiled
+	}
+
+	return engine, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, candidate := range tags {
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNormalizedTag checks if any of the tags normalizes to the given one
+func (rule *compiledRule) hasNormalizedTag(tags []string, tag string) bool {
+	for _, candidate := range tags {
+		if rule.normalizer.Tag(candidate) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule *compiledRule) matches(entry *ytdlwrapper.Entry, tags []string) bool {
+	match := &rule.Match
+
+	if match.Extractor != "" && !strings.EqualFold(match.Extractor, entry.Extractor) {
+		return false
+	}
+	if match.ChannelID != "" && match.ChannelID != entry.ChannelID {
+		return false
+	}
+	if match.Uploader != "" && match.Uploader != entry.UploaderID {
+		return false
+	}
+	if rule.title != nil && !rule.title.MatchString(entry.Title) {
+		return false
+	}
+	if match.MinDuration > 0 && (entry.Duration == 0 || entry.Duration < match.MinDuration) {
+		return false
+	}
+	if match.MaxDuration > 0 && (entry.Duration == 0 || entry.Duration > match.MaxDuration) {
+		return false
+	}
+	for _, tag := range match.HasTags {
+		if !rule.hasNormalizedTag(tags, tag) {
+			return false
+		}
+	}
+	for _, tag := range match.SourceTags {
+		if !containsFold(entry.Tags, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (rule *compiledRule) apply(tags []string) []string {
+	changed := make([]string, 0, len(tags)+len(rule.Add))
+	for _, tag := range tags {
+		normalized := rule.normalizer.Tag(tag)
+		if renamed, ok := rule.Rename[normalized]; ok {
+			tag, normalized = renamed, renamed
+		}
+		if hasTag(rule.Remove, normalized) || hasTag(changed, tag) {
+			continue
+		}
+		changed = append(changed, tag)
+	}
+
+	for _, tag := range rule.Add {
+		if !hasTag(changed, tag) {
+			changed = append(changed, tag)
+		}
+	}
+
+	return changed
+}
+
+// FormatProfiles returns the format profiles the rules refer to
+func (engine *Engine) FormatProfiles() []string {
+	profiles := []string{}
+	for _, rule := range engine.rules {
+		if rule.FormatProfile != "" {
+			profiles = append(profiles, rule.FormatProfile)
+		}
+	}
+	return profiles
+}
+
+// Apply every matching rule to the entry and its tags
+func (engine *Engine) Apply(entry *ytdlwrapper.Entry, tags []string) Result {
+	result := Result{
+		Tags:    tags,
+		Applied: []string{},
+	}
+
+	for i := range engine.rules {
+		rule := &engine.rules[i]
+		if !rule.matches(entry, result.Tags) {
+			continue
+		}
+		result.Tags = rule.apply(result.Tags)
+		result.Applied = append(result.Applied, rule.Name)
+		if rule.FormatProfile != "" {
+			result.FormatProfile = rule.FormatProfile
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,92 @@
+package tagrules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+func TestEngine_Apply(t *testing.T) {
+	engine, err := Make([]Rule{
+		{
+			Name:  "k-pop channel",
+			Match: Match{Extractor: "Youtube", ChannelID: "UC123"},
+			Add:   []string{"music", "music:k-pop"},
+		},
+		{
+			Match:  Match{Title: `(?i)\blive\b`, MinDuration: 600},
+			Rename: map[string]string{"music": "music:live"},
+			Remove: []string{"importer:cvi"},
+		},
+		{
+			Name:  "only after live",
+			Match: Match{HasTags: []string{"music:live"}},
+			Add:   []string{"Concert "},
+
+			FormatProfile: "best",
+		},
+	}, MakeNormalizer(Normalization{}))
+	if err != nil {
+		t.Fatalf("Make() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		entry       ytdlwrapper.Entry
+		tags        []string
+		wantTags    []string
+		wantApplied []string
+		wantProfile string
+	}{
+		{
+			name:        "no match",
+			entry:       ytdlwrapper.Entry{Extractor: "vimeo", ChannelID: "UC123", Title: "Live"},
+			tags:        []string{"importer:cvi"},
+			wantTags:    []string{"importer:cvi"},
+			wantApplied: []string{},
+		},
+		{
+			name:        "channel match",
+			entry:       ytdlwrapper.Entry{Extractor: "youtube", ChannelID: "UC123", Title: "Delivery"},
+			tags:        []string{"importer:cvi", "music"},
+			wantTags:    []string{"importer:cvi", "music", "music:k-pop"},
+			wantApplied: []string{"k-pop channel"},
+		},
+		{
+			name:        "chained rules",
+			entry:       ytdlwrapper.Entry{Extractor: "youtube", ChannelID: "UC123", Title: "LIVE at the stadium", Duration: 3600},
+			tags:        []string{"importer:cvi"},
+			wantTags:    []string{"music:live", "music:k-pop", "concert"},
+			wantApplied: []string{"k-pop channel", "rule 2", "only after live"},
+			wantProfile: "best",
+		},
+		{
+			name:        "unknown duration",
+			entry:       ytdlwrapper.Entry{Extractor: "youtube", ChannelID: "UC123", Title: "LIVE at the stadium"},
+			tags:        []string{},
+			wantTags:    []string{"music", "music:k-pop"},
+			wantApplied: []string{"k-pop channel"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := engine.Apply(&tt.entry, tt.tags)
+			if !reflect.DeepEqual(got.Tags, tt.wantTags) {
+				t.Errorf("Apply() tags = %v, want %v", got.Tags, tt.wantTags)
+			}
+			if !reflect.DeepEqual(got.Applied, tt.wantApplied) {
+				t.Errorf("Apply() applied = %v, want %v", got.Applied, tt.wantApplied)
+			}
+			if got.FormatProfile != tt.wantProfile {
+				t.Errorf("Apply() format profile = %v, want %v", got.FormatProfile, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestMake_invalidTitle(t *testing.T) {
+	if _, err := Make([]Rule{{Match: Match{Title: "("}}}, MakeNormalizer(Normalization{})); err == nil {
+		t.Error("Make() accepted an invalid title expression")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+)
+
+func thumbnailPrefix(id creamqueue.JobID) string {
+	return string(id) + ".thumbnail"
+}
+
+// thumbnailArgs makes yt-dlp write the source's thumbnail next to the download
+func thumbnailArgs(id creamqueue.JobID) []string {
+	return []string{
+		"--write-thumbnail",
+		"--convert-thumbnails", "jpg",
+		"-o", "thumbnail:" + thumbnailPrefix(id) + ".%(ext)s",
+	}
+}
+
+func removeThumbnails(id creamqueue.JobID) {
+	matches, _ := filepath.Glob(thumbnailPrefix(id) + ".*")
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+// findThumbnail returns the thumbnail written by yt-dlp, or extracts a frame
+// from the downloaded video if the source has none
+func findThumbnail(ctx context.Context, id creamqueue.JobID, video string, duration float64) (string, error) {
+	prefix := thumbnailPrefix(id)
+
+	if _, err := os.Stat(prefix + ".jpg"); err == nil {
+		return prefix + ".jpg", nil
+	}
+	// converting needs ffmpeg, without it the original format is kept
+	if matches, _ := filepath.Glob(prefix + ".*"); len(matches) > 0 {
+		return matches[0], nil
+	}
+
+	// skip past intros and black frames at the start
+	at := time.Duration(duration/10) * time.Second
+	output := prefix + ".jpg"
+	if err := ffmpegwrapper.Make().ExtractFrame(ctx, video, at, output); err != nil {
+		return "", err
+	}
+	return output, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+const localSourceUpload = "upload"
+
+// stagedUploadPrefix starts the name of every folder holding an uploaded file
+const stagedUploadPrefix = "upload-"
+
+// maxUploadMemory is how much of an upload is kept in memory before
+// the rest is written to a temporary file
+const maxUploadMemory = 32 << 20
+
+// uploadFileName returns the base name of a file as sent by a browser,
+// which might include a Windows path
+func uploadFileName(raw string) string {
+	name := filepath.Base(strings.Replace(raw, "\\", "/", -1))
+	if name == "." || name == "/" || name == ".." {
+		return "upload"
+	}
+	return name
+}
+
+// stageUpload copies the uploaded file into a new folder of the staging directory,
+// keeping its name so titles can be built from it
+func stageUpload(stagingDir, name string, file io.Reader) (string, error) {
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", err
+	}
+
+	directory, err := ioutil.TempDir(stagingDir, stagedUploadPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(directory, uploadFileName(name))
+	staged, err := os.Create(path)
+	if err == nil {
+		_, err = io.Copy(staged, file)
+		if closeErr := staged.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(directory)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// removeStagedUpload deletes the staged file of a job queued from an upload
+func removeStagedUpload(data creamqueue.JobData) {
+	if data.LocalSource != localSourceUpload {
+		return
+	}
+
+	directory := filepath.Dir(data.LocalPath)
+	if filepath.Dir(directory) != filepath.Clean(config.stagingDir) || !strings.HasPrefix(filepath.Base(directory), stagedUploadPrefix) {
+		return
+	}
+
+	if err := os.RemoveAll(directory); err != nil {
+		log.Println("failed removing staged upload", directory, err)
+	}
+}
+
+// cleanStaging removes uploads left behind by a previous run,
+// their jobs didn't survive the restart
+func cleanStaging(stagingDir string) {
+	matches, _ := filepath.Glob(filepath.Join(stagingDir, stagedUploadPrefix+"*"))
+	for _, match := range matches {
+		log.Println("removing stale upload", match)
+		os.RemoveAll(match)
+	}
+}
+
+// uploadFromForm stages the "file" upload and queues a job importing it
+func uploadFromForm(w http.ResponseWriter, r *http.Request) (creamqueue.JobID, int, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, config.maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadMemory); err != nil {
+		// the multipart reader wraps the error of http.MaxBytesReader
+		if strings.Contains(err.Error(), "request body too large") {
+			return "", 413, errors.New("file is too large")
+		}
+		return "", 400, errors.New("bad data")
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	data, err := jobDataFromForm(r)
+	if err != nil {
+		return "", 422, err
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return "", 422, errors.New("missing \"file\" upload")
+	}
+	defer file.Close()
+
+	path, err := stageUpload(config.stagingDir, header.Filename, file)
+	if err != nil {
+		log.Println("failed staging upload", err)
+		return "", 500, errors.New("failed storing upload")
+	}
+
+	data.URL = "upload:" + filepath.Base(path)
+	data.LocalPath = path
+	data.LocalSource = localSourceUpload
+
+	return queueJob(data), 200, nil
+}
+
+func handlerCreateJobFromUpload(w http.ResponseWriter, r *http.Request) {
+	if _, status, err := uploadFromForm(w, r); err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	http.Redirect(w, r, "/", 302)
+}
+
+func handlerAPICreateJobFromUpload(w http.ResponseWriter, r *http.Request) {
+	id, status, err := uploadFromForm(w, r)
+	if err != nil {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, 201, struct {
+		ID creamqueue.JobID `json:"id"`
+	}{id})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_stageUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "holiday.mp4", "holiday.mp4"},
+		{"windows path", `C:\Users\me\Videos\holiday.mp4`, "holiday.mp4"},
+		{"traversal", "../../etc/holiday.mp4", "holiday.mp4"},
+		{"no name", "", "upload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stagingDir := filepath.Join(t.TempDir(), "staging")
+
+			path, err := stageUpload(stagingDir, tt.filename, strings.NewReader("video"))
+			if err != nil {
+				t.Fatalf("stageUpload() error = %v", err)
+			}
+			if filepath.Base(path) != tt.want {
+				t.Errorf("stageUpload() = %v, want a file named %v", path, tt.want)
+			}
+			if filepath.Dir(filepath.Dir(path)) != stagingDir {
+				t.Errorf("stageUpload() = %v, want a file inside %v", path, stagingDir)
+			}
+
+			content, err := ioutil.ReadFile(path)
+			if err != nil || string(content) != "video" {
+				t.Errorf("stageUpload() wrote %q, %v", content, err)
+			}
+		})
+	}
+}
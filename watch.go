@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+const localSourceWatchFolder = "watch-folder"
+
+const (
+	watchFolderDone   = "done"
+	watchFolderFailed = "failed"
+)
+
+// watchPollInterval is how often watch folders are scanned
+const watchPollInterval = 5 * time.Second
+
+// watchFolder is an entry of "watch_folders" in the config file
+type watchFolder struct {
+	Path string   `json:"path"`
+	Tags []string `json:"tags"`
+	// StableSeconds is how long a file has to stay unchanged before it is imported,
+	// so files still being written are left alone. Defaults to 10.
+	StableSeconds int `json:"stable_seconds"`
+}
+
+func (folder *watchFolder) stableFor() time.Duration {
+	if folder.StableSeconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(folder.StableSeconds) * time.Second
+}
+
+// fileSnapshot is what a watched file looked like, and since when
+type fileSnapshot struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// A folderWatcher queues the files of a watch folder once they stop changing,
+// and moves them out of the way once their job is done
+type folderWatcher struct {
+	folder watchFolder
+	push   func(data creamqueue.JobData) creamqueue.JobID
+
+	lock      sync.Mutex
+	snapshots map[string]fileSnapshot
+	// queued files are left alone until their job is done
+	queued map[string]bool
+}
+
+func makeFolderWatcher(folder watchFolder, push func(data creamqueue.JobData) creamqueue.JobID) *folderWatcher {
+	return &folderWatcher{
+		folder:    folder,
+		push:      push,
+		snapshots: map[string]fileSnapshot{},
+		queued:    map[string]bool{},
+	}
+}
+
+// ignoreWatchedFile skips hidden files and the usual names of unfinished downloads
+func ignoreWatchedFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, suffix := range []string{".part", ".tmp", ".crdownload", ".partial", ".download"} {
+		if strings.HasSuffix(strings.ToLower(name), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan queues every file that hasn't changed for long enough
+func (watcher *folderWatcher) scan(now time.Time) error {
+	files, err := ioutil.ReadDir(watcher.folder.Path)
+	if err != nil {
+		return err
+	}
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	seen := map[string]bool{}
+	for _, file := range files {
+		if !file.Mode().IsRegular() || ignoreWatchedFile(file.Name()) {
+			continue
+		}
+
+		path := filepath.Join(watcher.folder.Path, file.Name())
+		seen[path] = true
+		if watcher.queued[path] {
+			continue
+		}
+
+		snapshot, ok := watcher.snapshots[path]
+		if !ok || snapshot.size != file.Size() || !snapshot.modTime.Equal(file.ModTime()) {
+			watcher.snapshots[path] = fileSnapshot{
+				size:    file.Size(),
+				modTime: file.ModTime(),
+				since:   now,
+			}
+			continue
+		}
+
+		if now.Sub(snapshot.since) < watcher.folder.stableFor() {
+			continue
+		}
+
+		delete(watcher.snapshots, path)
+		watcher.queued[path] = true
+		id := watcher.push(creamqueue.JobData{
+			URL:         localFileURL(path),
+			Tags:        append([]string{}, watcher.folder.Tags...),
+			GroupKey:    "watch:" + watcher.folder.Path,
+			LocalPath:   path,
+			LocalSource: localSourceWatchFolder,
+		})
+		log.Println("watch folder queued", id, path)
+	}
+
+	// files that disappeared start over if they come back
+	for path := range watcher.snapshots {
+		if !seen[path] {
+			delete(watcher.snapshots, path)
+		}
+	}
+
+	return nil
+}
+
+// owns returns true if the file was queued by this watcher,
+// or is one of its failed files being retried
+func (watcher *folderWatcher) owns(path string) bool {
+	if filepath.Dir(path) == filepath.Join(watcher.folder.Path, watchFolderFailed) {
+		return true
+	}
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+	return watcher.queued[path]
+}
+
+// done moves the file of a finished or failed job into the matching subfolder,
+// returning where the file is now
+func (watcher *folderWatcher) done(id creamqueue.JobID, path string, succeeded bool) string {
+	subfolder := watchFolderFailed
+	if succeeded {
+		subfolder = watchFolderDone
+	}
+
+	target := path
+	directory := filepath.Join(watcher.folder.Path, subfolder)
+	if filepath.Dir(path) != directory {
+		moved, err := moveIntoFolder(path, directory, string(id))
+		if err != nil {
+			log.Println("watch folder failed moving", path, err)
+		} else {
+			log.Println("watch folder moved", path, "to", moved)
+			target = moved
+		}
+	}
+
+	watcher.lock.Lock()
+	delete(watcher.queued, path)
+	watcher.lock.Unlock()
+
+	return target
+}
+
+// moveIntoFolder moves the file into the folder,
+// adding the suffix to its name if the folder has a file of that name already
+func moveIntoFolder(path, directory, suffix string) (string, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(path)
+	target := filepath.Join(directory, name)
+	if _, err := os.Stat(target); err == nil {
+		extension := filepath.Ext(name)
+		target = filepath.Join(directory, strings.TrimSuffix(name, extension)+"-"+suffix+extension)
+	}
+
+	return target, os.Rename(path, target)
+}
+
+// watchJobs moves the files of the watchers once their jobs are done
+func watchJobs(watchers []*folderWatcher) {
+	watcherOf := func(data creamqueue.JobData) *folderWatcher {
+		if data.LocalSource != localSourceWatchFolder {
+			return nil
+		}
+		for _, watcher := range watchers {
+			if watcher.owns(data.LocalPath) {
+				return watcher
+			}
+		}
+		return nil
+	}
+
+	queue.OnFinished(func(id creamqueue.JobID, data creamqueue.JobData, result creamqueue.JobResult) {
+		if watcher := watcherOf(data); watcher != nil {
+			watcher.done(id, data.LocalPath, true)
+		}
+	})
+
+	queue.OnFailed(func(id creamqueue.JobID, data creamqueue.JobData, failures []creamqueue.JobFailure) {
+		if watcher := watcherOf(data); watcher != nil {
+			// retrying the job imports the file from where it was moved to
+			target := watcher.done(id, data.LocalPath, false)
+			jobRepo.Update(id, func(job *jobInformation) {
+				job.Data.LocalPath = target
+			})
+		}
+	})
+
+	// cancelled files are moved out of the way too, or they would never be queued again
+	onCancelled(func(id creamqueue.JobID, data creamqueue.JobData) {
+		if watcher := watcherOf(data); watcher != nil {
+			watcher.done(id, data.LocalPath, false)
+		}
+	})
+}
+
+// bootWatchFolders scans the configured watch folders until the context is done
+func bootWatchFolders(ctx context.Context, folders []watchFolder) chan bool {
+	watchers := make([]*folderWatcher, len(folders))
+	for i, folder := range folders {
+		watchers[i] = makeFolderWatcher(folder, queueJob)
+	}
+
+	watchJobs(watchers)
+
+	finished := make(chan bool, 1)
+	go func() {
+		defer func() {
+			finished <- true
+		}()
+
+		if len(watchers) == 0 {
+			return
+		}
+
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, watcher := range watchers {
+				if err := watcher.scan(time.Now()); err != nil {
+					log.Println("watch folder scan failed", watcher.folder.Path, err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return finished
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+)
+
+func Test_folderWatcher(t *testing.T) {
+	folder := t.TempDir()
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(folder, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pushed := []creamqueue.JobData{}
+	watcher := makeFolderWatcher(watchFolder{Path: folder, Tags: []string{"phone"}}, func(data creamqueue.JobData) creamqueue.JobID {
+		pushed = append(pushed, data)
+		return creamqueue.JobID("1")
+	})
+
+	start := time.Now()
+	scan := func(after time.Duration, wantPushed int) {
+		t.Helper()
+		if err := watcher.scan(start.Add(after)); err != nil {
+			t.Fatal(err)
+		}
+		if len(pushed) != wantPushed {
+			t.Fatalf("after %v: pushed %v jobs, want %v", after, len(pushed), wantPushed)
+		}
+	}
+
+	write("clip.mp4", "1")
+	write(".hidden.mp4", "1")
+	write("recording.mp4.part", "1")
+	scan(0, 0)
+	scan(5*time.Second, 0)
+
+	// still being written: the clock starts over
+	write("clip.mp4", "12")
+	scan(8*time.Second, 0)
+	scan(15*time.Second, 0)
+	scan(18*time.Second, 1)
+
+	// queued files aren't queued twice
+	scan(60*time.Second, 1)
+
+	path := filepath.Join(folder, "clip.mp4")
+	if pushed[0].LocalPath != path || pushed[0].LocalSource != localSourceWatchFolder || pushed[0].Tags[0] != "phone" {
+		t.Errorf("pushed %+v", pushed[0])
+	}
+	if !watcher.owns(path) {
+		t.Errorf("owns() = false, want true")
+	}
+
+	watcher.done("1", path, true)
+	if _, err := os.Stat(filepath.Join(folder, watchFolderDone, "clip.mp4")); err != nil {
+		t.Errorf("file not moved to done: %v", err)
+	}
+	if watcher.owns(path) {
+		t.Errorf("owns() = true after done")
+	}
+
+	// a file of the same name fails later, and doesn't replace the first one
+	write("clip.mp4", "3")
+	scan(70*time.Second, 1)
+	scan(80*time.Second, 2)
+	failed := watcher.done("2", path, false)
+	if failed != filepath.Join(folder, watchFolderFailed, "clip.mp4") {
+		t.Errorf("done() = %v, want the file in failed", failed)
+	}
+	if _, err := os.Stat(failed); err != nil {
+		t.Errorf("file not moved to failed: %v", err)
+	}
+
+	// retried failed files stay where they are until they are imported
+	if !watcher.owns(failed) {
+		t.Errorf("owns() = false for a failed file")
+	}
+	if got := watcher.done("2", failed, false); got != failed {
+		t.Errorf("done() = %v after failing again, want %v", got, failed)
+	}
+
+	write("clip.mp4", "4")
+	scan(90*time.Second, 2)
+	scan(100*time.Second, 3)
+	watcher.done("3", path, true)
+	if _, err := os.Stat(filepath.Join(folder, watchFolderDone, "clip-3.mp4")); err != nil {
+		t.Errorf("file not moved to done with a suffix: %v", err)
+	}
+
+	watcher.done("2", failed, true)
+	if _, err := os.Stat(filepath.Join(folder, watchFolderDone, "clip-2.mp4")); err != nil {
+		t.Errorf("retried file not moved to done: %v", err)
+	}
+}
+
+func Test_watchJobs_cancelled(t *testing.T) {
+	useTestQueue(t)
+
+	folder := t.TempDir()
+	path := filepath.Join(folder, "clip.mp4")
+	if err := ioutil.WriteFile(path, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var id creamqueue.JobID
+	watcher := makeFolderWatcher(watchFolder{Path: folder}, func(data creamqueue.JobData) creamqueue.JobID {
+		id = queueJob(data)
+		return id
+	})
+	watchJobs([]*folderWatcher{watcher})
+
+	start := time.Now()
+	for _, after := range []time.Duration{0, time.Minute} {
+		if err := watcher.scan(start.Add(after)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if id == "" {
+		t.Fatal("file wasn't queued")
+	}
+
+	if !cancelWaitingJob(id) {
+		t.Fatal("cancelWaitingJob() = false")
+	}
+	if watcher.owns(path) {
+		t.Error("owns() = true after the job was cancelled")
+	}
+	if _, err := os.Stat(filepath.Join(folder, watchFolderFailed, "clip.mp4")); err != nil {
+		t.Errorf("cancelled file not moved to failed: %v", err)
+	}
+}
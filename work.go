@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
 	"github.com/AlbinoDrought/creamy-videos-importer/creamyvideos"
+	"github.com/AlbinoDrought/creamy-videos-importer/directdownload"
+	"github.com/AlbinoDrought/creamy-videos-importer/ffmpegwrapper"
+	"github.com/AlbinoDrought/creamy-videos-importer/tagrules"
 	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
 	"github.com/dustin/go-humanize"
 )
@@ -23,14 +29,218 @@ func workQueue(ctx context.Context) {
 	}
 }
 
+// importTags returns the tags requested for the job, followed by the ones
+// describing where the video came from and the ones mapped from its metadata
+func importTags(jobData *creamqueue.JobData, entry *ytdlwrapper.Entry) []string {
+	tags := append([]string{}, jobData.Tags...)
+
+	tags = append(tags, "importer:cvi")
+
+	if entry.Extractor != "" {
+		tags = append(tags, "extractor:"+entry.Extractor)
+
+		if entry.ChannelID != "" {
+			tags = append(tags, fmt.Sprintf("%v-channel:%v", entry.Extractor, entry.ChannelID))
+		}
+
+		if entry.UploaderID != "" {
+			tags = append(tags, fmt.Sprintf("%v-uploader:%v", entry.Extractor, entry.UploaderID))
+		}
+
+		if entry.ID != "" {
+			tags = append(tags, fmt.Sprintf("%v-id:%v", entry.Extractor, entry.ID))
+		}
+	}
+
+	if jobData.ParentPlaylistID != "" {
+		prefix := "imported-playlist"
+		if jobData.ParentPlaylistExtractor != "" {
+			prefix = strings.Replace(jobData.ParentPlaylistExtractor, ":playlist", "", -1) + "-playlist"
+		}
+		tags = append(tags, prefix+":"+jobData.ParentPlaylistID)
+		if jobData.PlaylistIndex > 0 {
+			tags = append(tags, fmt.Sprintf("%v-index:%v", prefix, jobData.PlaylistIndex))
+		}
+	}
+
+	if config.tagSubmitter && jobData.SubmittedBy != "" {
+		tags = append(tags, "submitted-by:"+jobData.SubmittedBy)
+	}
+
+	tags = append(tags, tagNormalizer.Tags(metadataTags.Map(entry))...)
+
+	return tagrules.Dedupe(tags)
+}
+
+// An importPlan is how a single video is imported, decided by its job and the tag rules
+type importPlan struct {
+	Tags []string
+	// Rules are the names of the tag rules that matched
+	Rules             []string
+	FormatProfileName string
+	Profile           formatProfile
+}
+
+// planImport applies the tag rules to the video and picks its format profile
+func planImport(jobData *creamqueue.JobData, entry *ytdlwrapper.Entry) importPlan {
+	result := tagRules.Apply(entry, importTags(jobData, entry))
+	name, profile := pickFormatProfile(jobData.FormatProfile, result.FormatProfile)
+	return importPlan{
+		Tags:              result.Tags,
+		Rules:             result.Applied,
+		FormatProfileName: name,
+		Profile:           profile,
+	}
+}
+
+// playlistChildData returns the job for a video found in a playlist,
+// inheriting the options of the playlist's job
+func playlistChildData(parentID creamqueue.JobID, parent *creamqueue.JobData, playlist *ytdlwrapper.Playlist, entry *ytdlwrapper.Entry) creamqueue.JobData {
+	child := *parent
+	child.URL = entry.BestURL()
+	child.Tags = append([]string{}, parent.Tags...)
+	child.ParentJobID = parentID
+	child.ParentPlaylistID = playlist.ID
+	child.ParentPlaylistExtractor = playlist.Extractor
+	child.PlaylistIndex = entry.PlaylistIndex
+	child.PlaylistTitle = playlist.Title
+	child.PlaylistAncestry = append(append([]creamqueue.PlaylistRef{}, parent.PlaylistAncestry...), playlistRef(playlist, parent.URL))
+	// the parent already waited
+	child.NotBefore = time.Time{}
+	child.Playlist = nestedPlaylistOptions(&parent.Playlist)
+	return child
+}
+
+// recode runs the downloaded file through ffmpeg if the profile asks for it,
+// returning the file to upload
+func recode(ctx context.Context, job creamqueue.QueuedJob, name string, profile *recodeProfile, input string, duration float64) (string, error) {
+	if profile.Mode == "" {
+		return input, nil
+	}
+
+	wrapper := ffmpegwrapper.Make()
+
+	job.Progress(creamqueue.JobProgress("Probing download"))
+	probed, err := wrapper.Probe(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed probing download: %w", err)
+	}
+	if !profile.needed(input, probed) {
+		return input, nil
+	}
+	if probed.Duration > 0 {
+		duration = probed.Duration
+	}
+
+	output := string(job.ID()) + ".recoded.mp4"
+	os.Remove(output)
+
+	job.Progress(creamqueue.JobProgress(fmt.Sprintf("Starting post-processing (%v)", name)))
+	progressCallback := func(progress *ffmpegwrapper.Progress) {
+		job.Progress(creamqueue.JobProgress(fmt.Sprintf(
+			"Post-processing (%v) %.1f%% complete (%v @ %v)",
+			name,
+			progress.Percent(duration),
+			progress.OutTime.Truncate(time.Second),
+			progress.Speed,
+		)))
+	}
+
+	if err := wrapper.RunWithProgress(ctx, progressCallback, profile.args(input, output)...); err != nil {
+		os.Remove(output)
+		return "", err
+	}
+	return output, nil
+}
+
+// uploadVideo uploads the file to creamy-videos, reporting progress prefixed by the label
+func uploadVideo(job creamqueue.QueuedJob, label, file, title, description string, tags []string, attachments []creamyvideos.Attachment) (*creamyvideos.UploadResult, error) {
+	job.Progress(creamqueue.JobProgress(label + " starting"))
+	uploadProgressCallback := func(current, total int64) {
+		job.Progress(creamqueue.JobProgress(fmt.Sprintf(
+			"%v %.1f%% complete (uploaded %v / %v)",
+			label,
+			(float32(current) / float32(total) * 100),
+			humanize.Bytes(uint64(current)),
+			humanize.Bytes(uint64(total)),
+		)))
+	}
+	return creamyvideos.UploadWithAttachments(
+		config.creamyVideosHost,
+		file,
+		title,
+		description,
+		tags,
+		attachments,
+		uploadProgressCallback,
+	)
+}
+
+// directEntry describes a direct media URL the way yt-dlp would
+func directEntry(direct *directdownload.Info) ytdlwrapper.Entry {
+	entry := ytdlwrapper.Entry{
+		Title:      direct.Title(),
+		Extractor:  "direct",
+		WebpageURL: direct.URL,
+	}
+	if direct.Size > 0 {
+		entry.Filesize = float64(direct.Size)
+	}
+	return entry
+}
+
+// removePartialDownloads deletes the partial direct download of the job.
+// It is kept between attempts so the next one can resume it.
+func removePartialDownloads(id creamqueue.JobID) {
+	matches, _ := filepath.Glob(string(id) + ".*part")
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+// fetchInfo asks yt-dlp about the URL, unless it points straight at a media file.
+// Only URLs ending in a media extension, and the ones yt-dlp doesn't support,
+// are probed, so pages don't cost an extra request. direct is only set for media files.
+func fetchInfo(ctx context.Context, wrapper *ytdlwrapper.Wrapper, downloader *directdownload.Downloader, url string) (info *ytdlwrapper.InfoOutput, direct *directdownload.Info, err error) {
+	probe := func() *directdownload.Info {
+		direct, err := downloader.Probe(ctx, url)
+		if err != nil || !direct.IsMedia() {
+			return nil
+		}
+		return direct
+	}
+
+	probed := directdownload.HasMediaExtension(url)
+	if probed {
+		if direct = probe(); direct != nil {
+			return &ytdlwrapper.InfoOutput{Entry: directEntry(direct)}, direct, nil
+		}
+	}
+
+	// pages, and servers refusing HEAD requests, are left to yt-dlp
+	info, err = wrapper.Info(ctx, url)
+	if err != nil && !probed && ytdlwrapper.IsUnsupportedURL(err) {
+		// media files without an extension, like download links
+		if direct = probe(); direct != nil {
+			return &ytdlwrapper.InfoOutput{Entry: directEntry(direct)}, direct, nil
+		}
+	}
+	return info, nil, err
+}
+
 func processJob(ctx context.Context, job creamqueue.QueuedJob) {
 	jobData := job.Data()
+	if jobData.LocalPath != "" {
+		processLocalJob(ctx, job)
+		return
+	}
+
 	url := jobData.URL
-	tags := jobData.Tags
 	wrapper := ytdlwrapper.Make()
+	downloader := directdownload.Make()
 
 	job.Progress(creamqueue.JobProgress("Fetching info"))
-	info, err := wrapper.Info(ctx, url)
+	info, direct, err := fetchInfo(ctx, wrapper, downloader, url)
 	if err != nil {
 		job.Progress(creamqueue.JobProgress("Failed fetching info"))
 		job.Failed(&creamqueue.JobFailure{
@@ -40,31 +250,32 @@ func processJob(ctx context.Context, job creamqueue.QueuedJob) {
 	}
 
 	if info.IsPlaylist {
-		if jobData.ParentPlaylistID != "" {
-			// https://github.com/AlbinoDrought/creamy-videos-importer/issues/11
-			// Some playlists try to re-import themselves, leading to an endless loop.
-			// To fix this, abort import if a playlist tries to import a playlist.
-			job.Progress(creamqueue.JobProgress("Job triggered by playlist import is another playlist! Aborting"))
+		// https://github.com/AlbinoDrought/creamy-videos-importer/issues/11
+		// Some playlists try to re-import themselves, leading to an endless loop.
+		if err := checkPlaylistNesting(jobData.PlaylistAncestry, playlistRef(&info.Playlist, url), config.maxPlaylistDepth); err != nil {
+			job.Progress(creamqueue.JobProgress("Job triggered by playlist import can't be expanded! Aborting"))
 			job.Failed(&creamqueue.JobFailure{
-				Error: fmt.Errorf(
-					"Job triggered by parent playlist %s tried to import another playlist %s, aborting",
-					jobData.ParentPlaylistID,
-					info.Playlist.ID,
-				),
+				Error: err,
 			})
 			return
 		}
 
-		for _, entry := range info.Playlist.Entries {
-			queue.Push(idGenerator.Next(), creamqueue.JobData{
-				URL:                     entry.BestURL(),
-				Tags:                    tags,
-				ParentPlaylistID:        info.Playlist.ID,
-				ParentPlaylistExtractor: info.Playlist.Extractor,
+		entries, err := selectPlaylistEntries(info.Playlist.Entries, &jobData.Playlist)
+		if err != nil {
+			job.Progress(creamqueue.JobProgress("Failed picking playlist videos"))
+			job.Failed(&creamqueue.JobFailure{
+				Error: err,
 			})
+			return
+		}
+
+		children := make([]creamqueue.JobData, len(entries))
+		for i := range entries {
+			children[i] = playlistChildData(job.ID(), jobData, &info.Playlist, &entries[i])
 		}
+		expandPlaylist(job.ID(), children)
 
-		job.Progress(creamqueue.JobProgress("Queued child videos!"))
+		job.Progress(creamqueue.JobProgress(fmt.Sprintf("Picked %v of %v child videos!", len(entries), len(info.Playlist.Entries))))
 		job.Finished(&creamqueue.JobResult{
 			Title: "Playlist " + info.Playlist.ID,
 		})
@@ -73,37 +284,87 @@ func processJob(ctx context.Context, job creamqueue.QueuedJob) {
 
 	entryURL := info.Entry.BestURL()
 
-	// todo: --recode-output mp4 might be useful
-	job.Progress(creamqueue.JobProgress("Fetching output filename"))
-	outputFilenameBytes, err := wrapper.Download(ctx, entryURL, "--no-playlist", "--get-filename", "-f", "best[ext=mp4]/best[ext=webm]/best/mp4/webm", "-o", string(job.ID())+".%(ext)s")
+	plan := planImport(jobData, &info.Entry)
+	tags := plan.Tags
+	formatArgs := plan.Profile.args()
+
+	metadata, err := buildImportMetadata(jobData, &info.Entry, time.Now())
 	if err != nil {
-		job.Progress(creamqueue.JobProgress("Failed fetching output filename"))
+		job.Progress(creamqueue.JobProgress("Failed building title and description"))
 		job.Failed(&creamqueue.JobFailure{
 			Error: err,
 		})
 		return
 	}
 
-	outputFilename := strings.TrimSpace(string(outputFilenameBytes))
+	var outputFilename string
+	if direct != nil {
+		outputFilename = string(job.ID()) + direct.Extension()
+	} else {
+		job.Progress(creamqueue.JobProgress("Fetching output filename"))
+		outputFilenameBytes, err := wrapper.Download(ctx, entryURL, append([]string{"--no-playlist", "--get-filename", "-o", string(job.ID()) + ".%(ext)s"}, formatArgs...)...)
+		if err != nil {
+			job.Progress(creamqueue.JobProgress("Failed fetching output filename"))
+			job.Failed(&creamqueue.JobFailure{
+				Error: err,
+			})
+			return
+		}
+
+		outputFilename = strings.TrimSpace(string(outputFilenameBytes))
+	}
 
 	// cleanup any files now, and also queue their cleanup for later:
 	os.Remove(outputFilename)
 	defer os.Remove(outputFilename)
-	os.Remove(outputFilename + ".part")
-	defer os.Remove(outputFilename + ".part")
+	if direct == nil {
+		os.Remove(outputFilename + ".part")
+		defer os.Remove(outputFilename + ".part")
+	}
+	// partial direct downloads are resumed by the next attempt instead, see removePartialDownloads
+	if config.thumbnails {
+		defer removeThumbnails(job.ID())
+	}
 
 	job.Progress(creamqueue.JobProgress("Starting download"))
-	downloadProgressCallback := func(progress *ytdlwrapper.DownloadProgress) {
-		job.Progress(creamqueue.JobProgress(fmt.Sprintf(
-			"Download %v%% complete (downloaded %v / %v @ %v/s)",
-			progress.Percent,
-			humanize.Bytes(progress.Downloaded),
-			humanize.Bytes(progress.TotalSize),
-			humanize.Bytes(progress.Speed),
-		)))
-	}
+	subtitleOptions, wantSubtitles := pickSubtitleOptions(jobData)
+	if direct != nil {
+		// the file is all there is, no thumbnails or subtitles come with it
+		wantSubtitles = false
+
+		downloadProgressCallback := func(progress *directdownload.Progress) {
+			job.Progress(creamqueue.JobProgress(fmt.Sprintf(
+				"Download %.1f%% complete (downloaded %v / %v @ %v/s)",
+				progress.Percent(),
+				humanize.Bytes(progress.Downloaded),
+				humanize.Bytes(progress.TotalSize),
+				humanize.Bytes(progress.Speed),
+			)))
+		}
+
+		err = downloader.Download(ctx, direct.URL, outputFilename, downloadProgressCallback)
+	} else {
+		downloadProgressCallback := func(progress *ytdlwrapper.DownloadProgress) {
+			job.Progress(creamqueue.JobProgress(fmt.Sprintf(
+				"Download %v%% complete (downloaded %v / %v @ %v/s)",
+				progress.Percent,
+				humanize.Bytes(progress.Downloaded),
+				humanize.Bytes(progress.TotalSize),
+				humanize.Bytes(progress.Speed),
+			)))
+		}
 
-	err = wrapper.DownloadWithProgress(ctx, downloadProgressCallback, entryURL, "--no-playlist", "-f", "best[ext=mp4]/best[ext=webm]/best/mp4/webm", "-o", outputFilename)
+		downloadArgs := append([]string{"--no-playlist", "-o", outputFilename}, formatArgs...)
+		if config.thumbnails {
+			downloadArgs = append(downloadArgs, thumbnailArgs(job.ID())...)
+		}
+		if wantSubtitles {
+			downloadArgs = append(downloadArgs, ytdlwrapper.SubtitleArgs(subtitlePrefix(job.ID()), subtitleOptions)...)
+			defer removeSubtitles(job.ID())
+		}
+
+		err = wrapper.DownloadWithProgress(ctx, downloadProgressCallback, entryURL, downloadArgs...)
+	}
 	if err != nil {
 		job.Progress(creamqueue.JobProgress("Failed downloading"))
 		job.Failed(&creamqueue.JobFailure{
@@ -112,61 +373,78 @@ func processJob(ctx context.Context, job creamqueue.QueuedJob) {
 		return
 	}
 
-	title := info.Entry.Title
-	if title == "" {
-		title = "Import of " + url
-	}
-
-	description := "Original URL: " + url
-	if info.Entry.Description != "" {
-		description += "\n\n" + info.Entry.Description
-	}
-
-	tags = append(tags, "importer:cvi")
-
-	if info.Entry.Extractor != "" {
-		tags = append(tags, "extractor:"+info.Entry.Extractor)
+	importFile(ctx, job, &info.Entry, outputFilename, tags, metadata, wantSubtitles)
+}
 
-		if info.Entry.ChannelID != "" {
-			tags = append(tags, fmt.Sprintf("%v-channel:%v", info.Entry.Extractor, info.Entry.ChannelID))
-		}
+// importFile runs the post-processing stages on a file that is on disk already
+// and uploads it with the metadata rendered beforehand
+func importFile(ctx context.Context, job creamqueue.QueuedJob, entry *ytdlwrapper.Entry, file string, tags []string, metadata importMetadata, wantSubtitles bool) {
+	jobData := job.Data()
 
-		if info.Entry.UploaderID != "" {
-			tags = append(tags, fmt.Sprintf("%v-uploader:%v", info.Entry.Extractor, info.Entry.UploaderID))
+	attachments := []creamyvideos.Attachment{}
+	if config.thumbnails {
+		job.Progress(creamqueue.JobProgress("Preparing thumbnail"))
+		thumbnail, err := findThumbnail(ctx, job.ID(), file, entry.Duration)
+		if err != nil {
+			// the server can still generate one itself
+			log.Printf("job %v: failed preparing thumbnail: %v", job.ID(), err)
+		} else {
+			attachments = append(attachments, creamyvideos.Attachment{
+				FieldName: creamyvideos.FieldThumbnail,
+				LocalPath: thumbnail,
+			})
 		}
+	}
 
-		if info.Entry.ID != "" {
-			tags = append(tags, fmt.Sprintf("%v-id:%v", info.Entry.Extractor, info.Entry.ID))
-		}
+	recodeProfileName, recodeProfile := pickRecodeProfile(jobData.RecodeProfile)
+	uploadFilename, err := recode(ctx, job, recodeProfileName, &recodeProfile, file, entry.Duration)
+	if err != nil {
+		job.Progress(creamqueue.JobProgress("Failed post-processing"))
+		job.Failed(&creamqueue.JobFailure{
+			Error: err,
+		})
+		return
+	}
+	if uploadFilename != file {
+		defer os.Remove(uploadFilename)
 	}
 
-	if jobData.ParentPlaylistID != "" {
-		if jobData.ParentPlaylistExtractor != "" {
-			extractor := strings.Replace(jobData.ParentPlaylistExtractor, ":playlist", "", -1)
-			tags = append(tags, fmt.Sprintf("%v-playlist:%v", extractor, jobData.ParentPlaylistID))
+	if wantSubtitles {
+		job.Progress(creamqueue.JobProgress("Preparing subtitles"))
+		subtitles, err := findSubtitles(ctx, job.ID())
+		if err != nil {
+			log.Printf("job %v: failed preparing subtitles: %v", job.ID(), err)
+		} else if len(subtitles) > 0 && config.subtitles.Mode == subtitleModeEmbed {
+			uploadFilename, err = embedSubtitles(ctx, job, uploadFilename, subtitles)
+			if err != nil {
+				job.Progress(creamqueue.JobProgress("Failed embedding subtitles"))
+				job.Failed(&creamqueue.JobFailure{
+					Error: err,
+				})
+				return
+			}
+			defer os.Remove(uploadFilename)
 		} else {
-			tags = append(tags, "imported-playlist:"+jobData.ParentPlaylistID)
+			attachments = append(attachments, subtitleAttachments(subtitles)...)
 		}
 	}
 
-	job.Progress(creamqueue.JobProgress("Uploading"))
-	uploadProgressCallback := func(current, total int64) {
-		job.Progress(creamqueue.JobProgress(fmt.Sprintf(
-			"Upload %.1f%% complete (uploaded %v / %v)",
-			(float32(current) / float32(total) * 100),
-			humanize.Bytes(uint64(current)),
-			humanize.Bytes(uint64(total)),
-		)))
+	if splitsChapters(jobData, entry) {
+		result, err := uploadChapters(ctx, job, entry, uploadFilename, tags, metadata.Chapters, attachments)
+		if err != nil {
+			job.Progress(creamqueue.JobProgress("Failed uploading chapters"))
+			job.Failed(&creamqueue.JobFailure{
+				Error: err,
+			})
+			return
+		}
+
+		job.Progress(creamqueue.JobProgress("Uploaded all chapters!"))
+		job.Finished(result)
+		return
 	}
-	result, err := creamyvideos.UploadWithProgress(
-		config.creamyVideosHost,
-		outputFilename,
-		title,
-		description,
-		tags,
-		uploadProgressCallback,
-	)
 
+	result, err := uploadVideo(job, "Upload", uploadFilename, metadata.Title, metadata.Description, tags, attachments)
 	if err != nil {
 		job.Progress(creamqueue.JobProgress("Failed uploading"))
 		job.Failed(&creamqueue.JobFailure{
@@ -177,7 +455,7 @@ func processJob(ctx context.Context, job creamqueue.QueuedJob) {
 
 	job.Progress(creamqueue.JobProgress("Uploaded!"))
 	job.Finished(&creamqueue.JobResult{
-		Title:     info.Entry.Title,
+		Title:     metadata.Title,
 		CreamyURL: result.URL,
 	})
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AlbinoDrought/creamy-videos-importer/creamqueue"
+	"github.com/AlbinoDrought/creamy-videos-importer/directdownload"
+	"github.com/AlbinoDrought/creamy-videos-importer/tagrules"
+	"github.com/AlbinoDrought/creamy-videos-importer/ytdlwrapper"
+)
+
+func Test_planImport_generatedTags(t *testing.T) {
+	useTestTagging(t)
+
+	var err error
+	tagRules, err = tagrules.Make([]tagrules.Rule{
+		{
+			Name:   "channel",
+			Match:  tagrules.Match{HasTags: []string{"youtube-channel:UCxyzABC"}},
+			Rename: map[string]string{"youtube-uploader:SomeOne": "artist:SomeOne"},
+			Remove: []string{"youtube-id:dQw4w9WgXcQ"},
+			Add:    []string{"music"},
+		},
+	}, tagNormalizer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &ytdlwrapper.Entry{
+		ID:         "dQw4w9WgXcQ",
+		Extractor:  "youtube",
+		ChannelID:  "UCxyzABC",
+		UploaderID: "SomeOne",
+	}
+	plan := planImport(&creamqueue.JobData{Tags: []string{"video"}}, entry)
+
+	want := []string{"video", "importer:cvi", "extractor:youtube", "youtube-channel:UCxyzABC", "artist:someone", "music"}
+	if !reflect.DeepEqual(plan.Tags, want) {
+		t.Errorf("planImport() tags = %v, want %v", plan.Tags, want)
+	}
+	if !reflect.DeepEqual(plan.Rules, []string{"channel"}) {
+		t.Errorf("planImport() rules = %v, want [channel]", plan.Rules)
+	}
+}
+
+func Test_removePartialDownloads(t *testing.T) {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(workingDirectory)
+	})
+
+	files := map[string]bool{
+		"7.mp4.part":  false,
+		"7.part":      false,
+		"7.mp4":       true,
+		"70.mp4.part": true,
+	}
+	for name := range files {
+		if err := ioutil.WriteFile(name, []byte("1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removePartialDownloads("7")
+
+	for name, wantKept := range files {
+		_, err := os.Stat(name)
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("%v kept = %v, want %v", name, kept, wantKept)
+		}
+	}
+}
+
+func Test_fetchInfo(t *testing.T) {
+	// stands in for yt-dlp, which only knows about pages
+	ytdl := filepath.Join(t.TempDir(), "yt-dlp")
+	script := "#!/bin/sh\nfor url; do :; done\ncase \"$url\" in\n*/watch*) echo '{\"id\": \"abc\", \"title\": \"Page\"}' ;;\n*) echo \"ERROR: Unsupported URL: $url\" >&2; exit 1 ;;\nesac\n"
+	if err := ioutil.WriteFile(ytdl, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wrapper := &ytdlwrapper.Wrapper{BinPath: ytdl}
+
+	probes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes++
+		if strings.HasPrefix(r.URL.Path, "/watch") {
+			w.Header().Set("Content-Type", "text/html")
+			return
+		}
+		w.Header().Set("Content-Type", "video/mp4")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantDirect bool
+		wantProbes int
+	}{
+		{name: "page", path: "/watch?v=abc", wantDirect: false, wantProbes: 0},
+		{name: "media extension", path: "/bunny.mp4", wantDirect: true, wantProbes: 1},
+		{name: "unsupported by yt-dlp", path: "/download?id=1", wantDirect: true, wantProbes: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probes = 0
+			info, direct, err := fetchInfo(context.Background(), wrapper, directdownload.Make(), server.URL+tt.path)
+			if err != nil {
+				t.Fatalf("fetchInfo() error = %v", err)
+			}
+			if (direct != nil) != tt.wantDirect {
+				t.Errorf("fetchInfo() direct = %+v, want direct %v", direct, tt.wantDirect)
+			}
+			if !tt.wantDirect && info.Entry.Title != "Page" {
+				t.Errorf("fetchInfo() title = %q, want the one from yt-dlp", info.Entry.Title)
+			}
+			if probes != tt.wantProbes {
+				t.Errorf("fetchInfo() sent %v probes, want %v", probes, tt.wantProbes)
+			}
+		})
+	}
+}
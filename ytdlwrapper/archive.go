@@ -0,0 +1,110 @@
+package ytdlwrapper
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const infoFileSuffix = ".info.json"
+
+// archivedMediaExtensions are the extensions yt-dlp might save videos with
+var archivedMediaExtensions = map[string]bool{
+	"mp4": true, "m4v": true, "mov": true, "webm": true, "mkv": true,
+	"avi": true, "flv": true, "3gp": true, "ogv": true, "ts": true,
+	"mp3": true, "m4a": true, "ogg": true, "opus": true, "flac": true, "wav": true,
+}
+
+// An ArchivedVideo is a file downloaded by yt-dlp with --write-info-json
+type ArchivedVideo struct {
+	MediaPath string
+	InfoPath  string
+}
+
+// FindArchived returns the media files of the directory that have a matching
+// .info.json file next to them, sorted by path
+func FindArchived(directory string, recursive bool) ([]ArchivedVideo, error) {
+	videos := []ArchivedVideo{}
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != directory && !recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(info.Name(), infoFileSuffix) {
+			return nil
+		}
+
+		if media := findArchivedMedia(path); media != "" {
+			videos = append(videos, ArchivedVideo{
+				MediaPath: media,
+				InfoPath:  path,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].MediaPath < videos[j].MediaPath
+	})
+	return videos, nil
+}
+
+// findArchivedMedia returns the media file belonging to the info file, if any.
+// "Video [id].info.json" belongs to "Video [id].mp4", but not to "Video [id].f137.mp4",
+// which is a leftover of merging formats.
+func findArchivedMedia(infoPath string) string {
+	base := strings.TrimSuffix(infoPath, infoFileSuffix)
+
+	matches, err := filepath.Glob(globEscape(base) + ".*")
+	if err != nil {
+		return ""
+	}
+
+	for _, match := range matches {
+		extension := strings.TrimPrefix(match, base+".")
+		if archivedMediaExtensions[strings.ToLower(extension)] {
+			return match
+		}
+	}
+	return ""
+}
+
+// globEscape escapes the characters filepath.Glob treats specially,
+// yt-dlp's default names put the video ID in square brackets
+func globEscape(path string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+	return replacer.Replace(path)
+}
+
+// ReadInfoFile decodes an .info.json file written by yt-dlp for a single video
+func ReadInfoFile(path string) (*Entry, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := unknownInfo{}
+	if err := json.Unmarshal(raw, &unknown); err != nil {
+		return nil, err
+	}
+	if unknown.Type == "playlist" {
+		return nil, errors.New("info file describes a playlist, not a video")
+	}
+
+	entry := &Entry{}
+	err = json.Unmarshal(raw, entry)
+	return entry, err
+}
@@ -0,0 +1,82 @@
+package ytdlwrapper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFindArchived(t *testing.T) {
+	directory := t.TempDir()
+	files := []string{
+		"Big Buck Bunny [aqz-KE-bpKQ].info.json",
+		"Big Buck Bunny [aqz-KE-bpKQ].mp4",
+		"Big Buck Bunny [aqz-KE-bpKQ].f137.mp4",
+		"Big Buck Bunny [aqz-KE-bpKQ].webp",
+		"Big Buck Bunny [aqz-KE-bpKQ].en.vtt",
+		"Sintel [eRsGyueVLvQ].info.json",
+		"Sintel [eRsGyueVLvQ].webm.part",
+		"nested/Tears of Steel [R6MlUcmOul8].info.json",
+		"nested/Tears of Steel [R6MlUcmOul8].mkv",
+	}
+	for _, file := range files {
+		path := filepath.Join(directory, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bunny := ArchivedVideo{
+		MediaPath: filepath.Join(directory, "Big Buck Bunny [aqz-KE-bpKQ].mp4"),
+		InfoPath:  filepath.Join(directory, "Big Buck Bunny [aqz-KE-bpKQ].info.json"),
+	}
+	tears := ArchivedVideo{
+		MediaPath: filepath.Join(directory, "nested/Tears of Steel [R6MlUcmOul8].mkv"),
+		InfoPath:  filepath.Join(directory, "nested/Tears of Steel [R6MlUcmOul8].info.json"),
+	}
+
+	tests := []struct {
+		name      string
+		recursive bool
+		want      []ArchivedVideo
+	}{
+		{"flat", false, []ArchivedVideo{bunny}},
+		{"recursive", true, []ArchivedVideo{bunny, tears}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindArchived(directory, tt.recursive)
+			if err != nil {
+				t.Fatalf("FindArchived() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindArchived() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadInfoFile(t *testing.T) {
+	directory := t.TempDir()
+	video := filepath.Join(directory, "video.info.json")
+	playlist := filepath.Join(directory, "playlist.info.json")
+	ioutil.WriteFile(video, []byte(`{"id": "aqz-KE-bpKQ", "title": "Big Buck Bunny", "extractor": "youtube", "duration": 635}`), 0644)
+	ioutil.WriteFile(playlist, []byte(`{"_type": "playlist", "id": "PL123"}`), 0644)
+
+	entry, err := ReadInfoFile(video)
+	if err != nil {
+		t.Fatalf("ReadInfoFile() error = %v", err)
+	}
+	if entry.ID != "aqz-KE-bpKQ" || entry.Title != "Big Buck Bunny" || entry.Extractor != "youtube" || entry.Duration != 635 {
+		t.Errorf("ReadInfoFile() = %+v", entry)
+	}
+
+	if _, err := ReadInfoFile(playlist); err == nil {
+		t.Errorf("ReadInfoFile() of a playlist error = nil, want an error")
+	}
+}
@@ -13,9 +13,102 @@ type Entry struct {
 	Extractor   string `json:"extractor"`
 	WebpageURL  string `json:"webpage_url"` // sometimes not set
 
+	// display names, unlike the IDs above
+	Uploader string `json:"uploader"`
+	Channel  string `json:"channel"`
+	Series   string `json:"series"`
+	Season   string `json:"season"`
+	Episode  string `json:"episode"`
+
+	// SeasonNumber and EpisodeNumber are 0 if unknown
+	SeasonNumber  int `json:"season_number"`
+	EpisodeNumber int `json:"episode_number"`
+	// PlaylistIndex is the 1-based position of the entry in its playlist, 0 if unknown
+	PlaylistIndex int `json:"playlist_index"`
+
+	Tags       []string `json:"tags"`
+	Categories []string `json:"categories"`
+
+	// Duration is in seconds, 0 if unknown
+	Duration float64 `json:"duration"`
+
+	Chapters []Chapter `json:"chapters"`
+
+	// Filesize and FilesizeApprox are for the format picked by default, see EstimatedSize
+	Filesize       float64  `json:"filesize"`
+	FilesizeApprox float64  `json:"filesize_approx"`
+	Formats        []Format `json:"formats"`
+	// RequestedFormats are set when the picked format is merged from several
+	RequestedFormats []Format `json:"requested_formats"`
+
 	// these are set for "URL"-type objects, returned from --flat-playlist
 	RawURL string `json:"url"`
 	IEKey  string `json:"ie_key"`
+	Type   string `json:"_type"`
+}
+
+// IsPlaylist returns true if the entry of a playlist is a playlist itself,
+// like the tabs listed for a channel
+func (entry *Entry) IsPlaylist() bool {
+	if entry.Type == "playlist" {
+		return true
+	}
+	// flat entries only say which extractor will expand them, like "YoutubeTab"
+	return strings.HasSuffix(entry.IEKey, "Tab") || strings.HasSuffix(entry.IEKey, "Playlist")
+}
+
+// A Chapter is a titled section of a video. Times are in seconds.
+type Chapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Title     string  `json:"title"`
+}
+
+// A Format is one of the ways a video can be downloaded
+type Format struct {
+	FormatID   string  `json:"format_id"`
+	Ext        string  `json:"ext"`
+	FormatNote string  `json:"format_note"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	FPS        float64 `json:"fps"`
+	VCodec     string  `json:"vcodec"`
+	ACodec     string  `json:"acodec"`
+
+	// Filesize and FilesizeApprox are in bytes, 0 if unknown.
+	// youtube-dl reports estimates as fractions.
+	Filesize       float64 `json:"filesize"`
+	FilesizeApprox float64 `json:"filesize_approx"`
+}
+
+// Size returns the size of the format in bytes, estimated if the exact one is unknown.
+// It is 0 if neither is known.
+func (format *Format) Size() int64 {
+	if format.Filesize > 0 {
+		return int64(format.Filesize)
+	}
+	return int64(format.FilesizeApprox)
+}
+
+// EstimatedSize returns the size in bytes of the format picked by default, 0 if unknown
+func (entry *Entry) EstimatedSize() int64 {
+	if entry.Filesize > 0 {
+		return int64(entry.Filesize)
+	}
+	if entry.FilesizeApprox > 0 {
+		return int64(entry.FilesizeApprox)
+	}
+
+	var size int64
+	for i := range entry.RequestedFormats {
+		formatSize := entry.RequestedFormats[i].Size()
+		if formatSize == 0 {
+			// a partial sum would look more precise than it is
+			return 0
+		}
+		size += formatSize
+	}
+	return size
 }
 
 // BestURL returns the most appropriate URL for an entry
@@ -41,9 +134,11 @@ func (entry *Entry) BestURL() string {
 
 // A Playlist is a list of entries
 type Playlist struct {
-	ID        string  `json:"id"`
-	Extractor string  `json:"extractor"`
-	Entries   []Entry `json:"entries"`
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Extractor  string  `json:"extractor"`
+	WebpageURL string  `json:"webpage_url"`
+	Entries    []Entry `json:"entries"`
 }
 
 // InfoOutput represents the JSON returned by `youtube-dl -J` or `yt-dlp -J`.
@@ -0,0 +1,52 @@
+package ytdlwrapper
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestEntry_EstimatedSize(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want int64
+	}{
+		{"exact", `{"filesize": 1000, "filesize_approx": 900}`, 1000},
+		{"approximate", `{"filesize": null, "filesize_approx": 900.5}`, 900},
+		{"merged", `{"requested_formats": [{"filesize": 700}, {"filesize_approx": 300}]}`, 1000},
+		{"merged, partly unknown", `{"requested_formats": [{"filesize": 700}, {}]}`, 0},
+		{"unknown", `{}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := Entry{}
+			if err := json.Unmarshal([]byte(tt.json), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if got := entry.EstimatedSize(); got != tt.want {
+				t.Errorf("EstimatedSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntry_IsPlaylist(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  bool
+	}{
+		{"video", Entry{IEKey: "Youtube"}, false},
+		{"channel tab", Entry{IEKey: "YoutubeTab"}, true},
+		{"playlist", Entry{IEKey: "YoutubePlaylist"}, true},
+		{"expanded playlist", Entry{Type: "playlist"}, true},
+		{"unknown", Entry{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.IsPlaylist(); got != tt.want {
+				t.Errorf("IsPlaylist() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
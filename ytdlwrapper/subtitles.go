@@ -0,0 +1,84 @@
+package ytdlwrapper
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SubtitleOptions picks which subtitles are downloaded next to the video
+type SubtitleOptions struct {
+	// Languages are passed as --sub-langs, like "en" or "de.*"
+	Languages []string
+	// AutoCaptions also downloads automatically generated subtitles
+	AutoCaptions bool
+}
+
+// SubtitleArgs returns the arguments writing the video's subtitles as
+// <prefix>.<language>.vtt, converted by yt-dlp where possible
+func SubtitleArgs(prefix string, options SubtitleOptions) []string {
+	args := []string{
+		"--write-subs",
+		"--sub-langs", strings.Join(options.Languages, ","),
+		"--convert-subs", "vtt",
+		"-o", "subtitle:" + prefix + ".%(ext)s",
+	}
+	if options.AutoCaptions {
+		args = append(args, "--write-auto-subs")
+	}
+	return args
+}
+
+// A Subtitle file written by yt-dlp
+type Subtitle struct {
+	Language string
+	// Format is the file extension, like "vtt" or "srt"
+	Format string
+	Path   string
+}
+
+// FindSubtitles returns the subtitle files written with the given prefix,
+// sorted by language
+func FindSubtitles(prefix string) ([]Subtitle, error) {
+	matches, err := filepath.Glob(prefix + ".*.*")
+	if err != nil {
+		return nil, err
+	}
+
+	subtitles := []Subtitle{}
+	for _, match := range matches {
+		if subtitle, ok := parseSubtitlePath(prefix, match); ok {
+			subtitles = append(subtitles, subtitle)
+		}
+	}
+
+	sort.Slice(subtitles, func(i, j int) bool {
+		return subtitles[i].Language < subtitles[j].Language
+	})
+	return subtitles, nil
+}
+
+func parseSubtitlePath(prefix, path string) (Subtitle, bool) {
+	// 12.subtitles.en.vtt
+	// 12.subtitles.en-US.srt
+	if !strings.HasPrefix(path, prefix+".") {
+		return Subtitle{}, false
+	}
+	rest := strings.TrimPrefix(path, prefix+".")
+
+	separator := strings.LastIndex(rest, ".")
+	if separator <= 0 || separator == len(rest)-1 {
+		return Subtitle{}, false
+	}
+
+	format := rest[separator+1:]
+	if format == "part" || format == "ytdl" {
+		return Subtitle{}, false
+	}
+
+	return Subtitle{
+		Language: rest[:separator],
+		Format:   format,
+		Path:     path,
+	}, true
+}
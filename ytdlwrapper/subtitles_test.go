@@ -0,0 +1,32 @@
+package ytdlwrapper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseSubtitlePath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		want   Subtitle
+		wantOk bool
+	}{
+		{"vtt", "12.subtitles.en.vtt", Subtitle{Language: "en", Format: "vtt", Path: "12.subtitles.en.vtt"}, true},
+		{"region", "12.subtitles.en-US.srt", Subtitle{Language: "en-US", Format: "srt", Path: "12.subtitles.en-US.srt"}, true},
+		{"unfinished", "12.subtitles.en.vtt.part", Subtitle{}, false},
+		{"no language", "12.subtitles.vtt", Subtitle{}, false},
+		{"other job", "123.subtitles.en.vtt", Subtitle{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSubtitlePath("12.subtitles", tt.path)
+			if ok != tt.wantOk {
+				t.Fatalf("parseSubtitlePath() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSubtitlePath() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
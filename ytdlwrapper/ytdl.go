@@ -2,8 +2,10 @@ package ytdlwrapper
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"os/exec"
 )
@@ -39,6 +41,12 @@ func (wrapper *Wrapper) Info(ctx context.Context, url string) (*InfoOutput, erro
 	return &infoOutput, err
 }
 
+// IsUnsupportedURL returns true if Info failed because no extractor supports the URL
+func IsUnsupportedURL(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && bytes.Contains(exitErr.Stderr, []byte("Unsupported URL"))
+}
+
 // Update youtube-dl or yt-dlp
 func (wrapper *Wrapper) Update(ctx context.Context) error {
 	_, err := exec.CommandContext(ctx, wrapper.BinPath, "-U").Output()